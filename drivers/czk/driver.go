@@ -1,788 +1,3371 @@
-package czk
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"log"
-	"mime/multipart"
-	"net/http"
-	"time"
-
-	"github.com/OpenListTeam/OpenList/v4/internal/driver"
-	"github.com/OpenListTeam/OpenList/v4/internal/errs"
-	"github.com/OpenListTeam/OpenList/v4/internal/model"
-	"github.com/OpenListTeam/OpenList/v4/internal/stream"
-	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
-	"github.com/go-resty/resty/v2"
-)
-
-// 驱动配置：名称改为"星辰云盘"，贴合需求
-var config = driver.Config{
-	Name: "星辰云盘",       // 核心修改：驱动显示名称为"星辰云盘"
-	Type: "object_storage", // 存储类型不变，符合对象存储操作逻辑
-}
-
-type CZK struct {
-	model.Storage
-	Addition
-	AccessToken  string
-	RefreshToken string
-	ExpiresAt    time.Time
-	client       *resty.Client
-}
-
-func (d *CZK) Init(ctx context.Context) error {
-	d.client = resty.New()
-	// 设置全局User-Agent
-	d.client.SetHeader("User-Agent", "openlist")
-	// 获取访问令牌
-	if err := d.authenticate(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (d *CZK) Drop(ctx context.Context) error {
-	return nil
-}
-
-func (d *CZK) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	// 根据API文档，文件列表接口需要在URL中包含folder_id参数，并在请求头中携带Authorization
-	url := fmt.Sprintf("https://pan.szczk.top/czkapi/list_files?folder_id=%s", dir.GetID())
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send list request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to list files with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应并返回文件列表
-	var listResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &listResp); err != nil {
-		log.Printf("CZK List: failed to parse file list response: %v, response body: %s", err, string(resp.Body()))
-		return nil, fmt.Errorf("failed to parse file list response: %w", err)
-	}
-	// 记录响应内容用于调试
-	log.Printf("CZK List response: %+v", listResp)
-	// 检查响应中是否有错误信息
-	if code, ok := listResp["code"].(float64); ok && int64(code) != 200 {
-		message := "unknown error"
-		if msg, ok := listResp["message"].(string); ok {
-			message = msg
-		}
-		return nil, fmt.Errorf("list files API error: code=%d, message=%s", int64(code), message)
-	}
-	// 从响应中提取文件数据
-	var objs []model.Obj
-	// 根据API示例，正确的结构是 {code, message, data: {items: [], total_count}}
-	if data, ok := listResp["data"].(map[string]interface{}); ok {
-		if items, ok := data["items"].([]interface{}); ok {
-			for _, itemData := range items {
-				if itemMap, ok := itemData.(map[string]interface{}); ok {
-					// 解析文件/文件夹信息
-					id := ""
-					if itemId, ok := itemMap["id"].(float64); ok {
-						id = fmt.Sprintf("%.0f", itemId) // ID是数字，转换为字符串
-					}
-					name := ""
-					if itemName, ok := itemMap["name"].(string); ok {
-						name = itemName
-					}
-					size := int64(0)
-					if itemSize, ok := itemMap["size"].(float64); ok {
-						size = int64(itemSize)
-					}
-					isFolder := false
-					if itemType, ok := itemMap["type"].(string); ok {
-						isFolder = (itemType == "folder")
-					}
-					// 解析时间
-					modifiedStr := ""
-					if isFolder {
-						if createdAt, ok := itemMap["created_at"].(string); ok {
-							modifiedStr = createdAt
-						}
-					} else {
-						if uploadedAt, ok := itemMap["uploaded_at"].(string); ok {
-							modifiedStr = uploadedAt
-						}
-					}
-					// 解析修改时间
-					var modified time.Time
-					if modifiedStr != "" {
-						// 尝试解析时间格式 "2025-06-29 15:37:01"
-						if t, err := time.Parse("2006-01-02 15:04:05", modifiedStr); err == nil {
-							modified = t
-						} else {
-							// 如果解析失败，使用当前时间
-							modified = time.Now()
-						}
-					} else {
-						modified = time.Now()
-					}
-					obj := &model.Object{
-						ID:       id,
-						Name:     name,
-						Size:     size,
-						Modified: modified,
-						IsFolder: isFolder,
-					}
-					objs = append(objs, obj)
-				}
-			}
-		}
-	}
-	log.Printf("CZK List: successfully listed %d files", len(objs))
-	return objs, nil
-}
-
-func (d *CZK) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	// 根据API文档，下载链接接口需要添加Authorization认证头部
-	url := fmt.Sprintf("https://pan.szczk.top/czkapi/get_download_url?file_id=%s", file.GetID())
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send get download link request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to get download link with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应并返回下载链接
-	var downloadResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &downloadResp); err != nil {
-		log.Printf("CZK Link: failed to parse download link response: %v, response body: %s", err, string(resp.Body()))
-		return nil, fmt.Errorf("failed to parse download link response: %w", err)
-	}
-	// 记录响应内容用于调试
-	log.Printf("CZK Link response: %+v", downloadResp)
-	// 检查响应中是否有错误信息
-	if status, ok := downloadResp["status"].(float64); ok && int64(status) != 200 {
-		message := "unknown error"
-		if msg, ok := downloadResp["message"].(string); ok {
-			message = msg
-		}
-		return nil, fmt.Errorf("get download link API error: status=%d, message=%s", int64(status), message)
-	}
-	// 从响应中提取下载链接
-	var downloadLink string
-	if data, ok := downloadResp["data"].(map[string]interface{}); ok {
-		// 尝试从不同字段获取下载链接
-		if link, ok := data["download_link"].(string); ok && link != "" {
-			downloadLink = link
-		} else if url, ok := data["url"].(string); ok && url != "" {
-			downloadLink = url
-		}
-	}
-	// 根据API文档，响应可能为空对象，这种情况下我们记录警告但不报错
-	if downloadLink == "" {
-		log.Printf("CZK Link: warning - no download link found in response: %+v", downloadResp)
-		return nil, fmt.Errorf("failed to get download link from response")
-	}
-	// 创建一个带有重试机制的链接
-	return &model.Link{
-		URL: downloadLink,
-		Header: http.Header{
-			"User-Agent": []string{"openlist"},
-		},
-	}, nil
-}
-
-func (d *CZK) authenticate() error {
-	url := "https://pan.szczk.top/czkapi/authenticate"
-	// 检查API密钥和密钥是否已设置
-	if d.APIKey == "" || d.APISecret == "" {
-		return fmt.Errorf("API key or secret not set")
-	}
-	// 设置请求超时时间
-	d.client.SetTimeout(30 * time.Second)
-	// 根据API文档，认证接口需要在请求头中包含x-api-key和x-api-secret
-	resp, err := d.client.R().
-		SetHeader("x-api-key", d.APIKey).
-		SetHeader("x-api-secret", d.APISecret).
-		Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to send auth request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("authentication failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
-	}
-	// 解析认证响应，获取access_token, refresh_token等
-	var authResp AuthResp
-	if err := json.Unmarshal(resp.Body(), &authResp); err != nil {
-		log.Printf("CZK authenticate: failed to parse auth response: %v, response body: %s", err, string(resp.Body()))
-		return fmt.Errorf("failed to parse auth response: %w, response body: %s", err, string(resp.Body()))
-	}
-	// 记录响应内容用于调试
-	log.Printf("CZK authenticate response: Status=%d, Message=%s, Data.AccessToken=%s***, Data.RefreshToken=%s***, Data.ExpiresIn=%d, Data.TokenType=%s",
-		authResp.Status, authResp.Message,
-		authResp.Data.AccessToken[:min(len(authResp.Data.AccessToken), 10)],
-		authResp.Data.RefreshToken[:min(len(authResp.Data.RefreshToken), 10)],
-		authResp.Data.ExpiresIn, authResp.Data.TokenType)
-	// 检查API返回的状态码
-	// 根据经验，即使status不是200，但如果message是"认证成功"，我们也认为认证成功
-	if authResp.Status != 200 && authResp.Message != "认证成功" {
-		return fmt.Errorf("authentication API error: status=%d, message=%s", authResp.Status, authResp.Message)
-	}
-	// 检查是否获得了必要的令牌
-	if authResp.Data.AccessToken == "" {
-		return fmt.Errorf("authentication succeeded but no access token returned")
-	}
-	if authResp.Data.RefreshToken == "" {
-		return fmt.Errorf("authentication succeeded but no refresh token returned")
-	}
-	// 更新令牌信息
-	d.AccessToken = authResp.Data.AccessToken
-	d.RefreshToken = authResp.Data.RefreshToken
-	d.ExpiresAt = time.Now().Add(time.Duration(authResp.Data.ExpiresIn) * time.Second)
-	log.Printf("CZK authenticate: successfully authenticated, access token: %s***, refresh token: %s***, expires at: %v",
-		d.AccessToken[:min(len(d.AccessToken), 10)], d.RefreshToken[:min(len(d.RefreshToken), 10)], d.ExpiresAt)
-	return nil
-}
-
-func (d *CZK) refreshTokenIfNeeded() error {
-	if time.Now().After(d.ExpiresAt) {
-		// 尝试刷新令牌
-		err := d.refreshToken()
-		if err != nil {
-			// 如果刷新令牌失败，尝试重新认证
-			log.Printf("Failed to refresh token: %v, attempting to re-authenticate", err)
-			return d.authenticate()
-		}
-	}
-	return nil
-}
-
-func (d *CZK) refreshToken() error {
-	url := "https://pan.szczk.top/czkapi/refresh_token"
-	// 检查是否有有效的刷新令牌
-	if d.RefreshToken == "" {
-		// 如果没有刷新令牌，需要重新进行认证
-		return fmt.Errorf("no refresh token available, need to re-authenticate")
-	}
-	log.Printf("CZK refreshToken: attempting to refresh token with refresh token: %s***", d.RefreshToken[:min(len(d.RefreshToken), 10)])
-	// 创建表单数据，根据API文档，只需要refresh_token字段
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("refresh_token", d.RefreshToken)
-	err := writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to create refresh token form: %w", err)
-	}
-	// 设置请求超时时间
-	d.client.SetTimeout(30 * time.Second)
-	// 根据API文档，刷新令牌接口使用POST方法，请求体使用multipart/form-data格式
-	resp, err := d.client.R().
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(url)
-	if err != nil {
-		return fmt.Errorf("failed to send refresh request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		log.Printf("CZK refreshToken: refresh request failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
-		return fmt.Errorf("token refresh failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
-	}
-	// 解析刷新令牌响应，更新access_token等
-	var refreshResp RefreshResp
-	if err := json.Unmarshal(resp.Body(), &refreshResp); err != nil {
-		log.Printf("CZK refreshToken: failed to parse refresh response: %v, response body: %s", err, string(resp.Body()))
-		return fmt.Errorf("failed to parse refresh response: %w, response body: %s", err, string(resp.Body()))
-	}
-	// 记录响应内容用于调试
-	log.Printf("CZK refreshToken response: Status=%d, Message=%s, Success=%t, Data.AccessToken=%s***, Data.ExpiresIn=%d, Data.TokenType=%s",
-		refreshResp.Status, refreshResp.Message, refreshResp.Success,
-		refreshResp.Data.AccessToken[:min(len(refreshResp.Data.AccessToken), 10)],
-		refreshResp.Data.ExpiresIn, refreshResp.Data.TokenType)
-	// 检查API返回的状态码和成功标志
-	// 当Success为true且Status为200时，表示刷新成功
-	if !refreshResp.Success || refreshResp.Status != 200 {
-		// 特别处理"需要提供刷新令牌"和"无效或过期的刷新令牌"的错误
-		if refreshResp.Message == "需要提供刷新令牌" || refreshResp.Message == "无效或过期的刷新令牌" {
-			return fmt.Errorf("token refresh API error: status=%d, success=%t, message=%s, refresh token may be invalid or expired", refreshResp.Status, refreshResp.Success, refreshResp.Message)
-		}
-		return fmt.Errorf("token refresh API error: status=%d, success=%t, message=%s", refreshResp.Status, refreshResp.Success, refreshResp.Message)
-	}
-	// 更新访问令牌和过期时间
-	d.AccessToken = refreshResp.Data.AccessToken
-	d.ExpiresAt = time.Now().Add(time.Duration(refreshResp.Data.ExpiresIn) * time.Second)
-	// 如果返回了新的刷新令牌，则更新它
-	if refreshResp.Data.RefreshToken != "" {
-		d.RefreshToken = refreshResp.Data.RefreshToken
-		log.Printf("CZK refreshToken: new refresh token received and updated: %s***", d.RefreshToken[:min(len(d.RefreshToken), 10)])
-	}
-	log.Printf("CZK refreshToken: successfully refreshed token, access token: %s***, expires at: %v",
-		d.AccessToken[:min(len(d.AccessToken), 10)], d.ExpiresAt)
-	return nil
-}
-
-// 以下方法为可选实现
-func (d *CZK) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	url := "https://pan.szczk.top/czkapi/create_folder"
-	// 创建表单数据
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("parent_id", parentDir.GetID())
-	_ = writer.WriteField("name", dirName)
-	err := writer.Close()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create mkdir form: %w", err)
-	}
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send mkdir request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to create folder with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应
-	var operationResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &operationResp); err != nil {
-		return nil, fmt.Errorf("failed to parse create folder response: %w", err)
-	}
-	// 检查响应中是否有错误信息
-	if code, ok := operationResp["code"].(float64); ok && int64(code) != 200 {
-		message := "unknown error"
-		if msg, ok := operationResp["msg"].(string); ok {
-			message = msg
-		} else if msg, ok := operationResp["message"].(string); ok {
-			message = msg
-		}
-		return nil, fmt.Errorf("create folder API error: code=%d, message=%s", int64(code), message)
-	}
-	// 从响应中提取新创建的文件夹ID
-	folderID := ""
-	if data, ok := operationResp["data"].(map[string]interface{}); ok {
-		if id, ok := data["folder_id"].(float64); ok {
-			folderID = fmt.Sprintf("%.0f", id)
-		}
-	}
-	// 返回新创建的目录对象
-	newObj := &model.Object{
-		ID:       folderID,
-		Name:     dirName,
-		Size:     0,
-		Modified: time.Now(),
-		IsFolder: true,
-	}
-	return newObj, nil
-}
-
-func (d *CZK) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	url := "https://pan.szczk.top/czkapi/move_item"
-	// 创建表单数据，根据API示例使用正确的参数名
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("id", srcObj.GetID())
-	_ = writer.WriteField("type", func() string {
-		if srcObj.IsDir() {
-			return "folder"
-		}
-		return "file"
-	}())
-	// 根据API规范，目标目录ID使用target_id参数名
-	_ = writer.WriteField("target_id", dstDir.GetID())
-	err := writer.Close()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create move form: %w", err)
-	}
-	// 根据POST接口调用规范，需要在请求头中携带Authorization认证信息
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send move request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to move item with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应
-	var operationResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &operationResp); err != nil {
-		return nil, fmt.Errorf("failed to parse move response: %w", err)
-	}
-	// 检查响应中是否有错误信息，根据API示例使用code字段
-	if code, ok := operationResp["code"].(float64); ok && int64(code) != 200 {
-		message := "unknown error"
-		if msg, ok := operationResp["message"].(string); ok {
-			message = msg
-		} else if msg, ok := operationResp["msg"].(string); ok {
-			// 根据示例响应，也可能使用msg字段
-			message = msg
-		}
-		return nil, fmt.Errorf("move item API error: code=%d, message=%s", int64(code), message)
-	}
-	// 根据API示例响应格式解析返回的数据
-	// 示例: {"code": 200, "msg": "成功", "data": {"items": [...]}}
-	newObj := &model.Object{
-		ID:       srcObj.GetID(),
-		Name:     srcObj.GetName(),
-		Size:     srcObj.GetSize(),
-		Modified: time.Now(),
-		IsFolder: srcObj.IsDir(),
-	}
-	// 从响应中提取更新后的对象信息
-	if data, ok := operationResp["data"].(map[string]interface{}); ok {
-		if items, ok := data["items"].([]interface{}); ok && len(items) > 0 {
-			// 查找被移动的对象
-			for _, itemData := range items {
-				if itemMap, ok := itemData.(map[string]interface{}); ok {
-					if id, ok := itemMap["id"].(float64); ok && fmt.Sprintf("%.0f", id) == srcObj.GetID() {
-						// 找到被移动的对象，更新信息
-						if name, ok := itemMap["name"].(string); ok {
-							newObj.Name = name
-						}
-						// parentId 是新的父目录ID，但模型中没有直接存储这个信息
-						// 我们只需要确保对象信息是最新的
-						_ = itemMap["parent_id"]
-						if createdAt, ok := itemMap["created_at"].(string); ok {
-							if t, err := time.Parse("2006-01-02 15:04:05", createdAt); err == nil {
-								newObj.Modified = t
-							}
-						}
-						break
-					}
-				}
-			}
-		}
-	}
-	return newObj, nil
-}
-
-func (d *CZK) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	url := "https://pan.szczk.top/czkapi/rename_item"
-	// 创建表单数据
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("id", srcObj.GetID())
-	_ = writer.WriteField("type", func() string {
-		if srcObj.IsDir() {
-			return "folder"
-		}
-		return "file"
-	}())
-	_ = writer.WriteField("new_name", newName)
-	err := writer.Close()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create rename form: %w", err)
-	}
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send rename request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to rename item with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应
-	var operationResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &operationResp); err != nil {
-		return nil, fmt.Errorf("failed to parse rename response: %w", err)
-	}
-	// 检查响应中是否有错误信息
-	if status, ok := operationResp["status"].(float64); ok && int64(status) != 200 {
-		message := "unknown error"
-		if msg, ok := operationResp["message"].(string); ok {
-			message = msg
-		}
-		return nil, fmt.Errorf("rename item API error: status=%d, message=%s", int64(status), message)
-	}
-	// 返回更新后的对象
-	// 注意：这里应该根据实际API响应来构建对象
-	// 目前我们简单地复制原对象并更新名称
-	newObj := &model.Object{
-		ID:       srcObj.GetID(),
-		Name:     newName,
-		Size:     srcObj.GetSize(),
-		Modified: time.Now(),
-		IsFolder: srcObj.IsDir(),
-	}
-	return newObj, nil
-}
-
-func (d *CZK) Remove(ctx context.Context, obj model.Obj) error {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return fmt.Errorf("failed to refresh token: %w", err)
-	}
-	url := "https://pan.szczk.top/czkapi/delete_item"
-	// 创建表单数据
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("id", obj.GetID())
-	_ = writer.WriteField("type", func() string {
-		if obj.IsDir() {
-			return "folder"
-		}
-		return "file"
-	}())
-	err := writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to create delete form: %w", err)
-	}
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(url)
-	if err != nil {
-		return fmt.Errorf("failed to send delete request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("failed to delete item with status %d: %s", resp.StatusCode(), resp.String())
-	}
-	// 解析响应
-	var operationResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &operationResp); err != nil {
-		return fmt.Errorf("failed to parse delete response: %w", err)
-	}
-	// 检查响应中是否有错误信息，根据API示例使用code字段
-	if code, ok := operationResp["code"].(float64); ok && int64(code) != 200 {
-		message := "unknown error"
-		if msg, ok := operationResp["msg"].(string); ok {
-			// 根据API文档，使用msg字段而非message字段
-			message = msg
-		}
-		return fmt.Errorf("delete item API error: code=%d, message=%s", int64(code), message)
-	}
-	return nil
-}
-
-// 修复后的Put方法（核心更新：补充文件上传步骤、提取file_id）
-func (d *CZK) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
-	if err := d.refreshTokenIfNeeded(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-	// 增加请求超时时间以提高大文件上传的稳定性
-	d.client.SetTimeout(10 * time.Minute)
-	defer d.client.SetTimeout(30 * time.Second) // 延迟恢复默认超时，确保所有步骤覆盖
-
-	// 1. 计算文件MD5并缓存文件流
-	tempFile, md5Hash, err := stream.CacheFullAndHash(file, &up, utils.MD5)
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate file md5: %w", err)
-	}
-	// 重置文件流至起始位置，用于后续上传
-	if seeker, ok := tempFile.(io.Seeker); ok {
-		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
-			return nil, fmt.Errorf("failed to seek file: %w", err)
-		}
-	}
-
-	// 2. 调用预备上传接口（first_upload）
-	initURL := "https://pan.szczk.top/czkapi/first_upload"
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("hash", md5Hash)
-	_ = writer.WriteField("filename", file.GetName())
-	_ = writer.WriteField("filesize", fmt.Sprintf("%d", file.GetSize()))
-	_ = writer.WriteField("folder", dstDir.GetID())
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to create init upload form: %w", err)
-	}
-
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", writer.FormDataContentType()).
-		SetBody(payload.Bytes()).
-		Post(initURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send init upload request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to initialize upload with status %d: %s", resp.StatusCode(), resp.String())
-	}
-
-	// 解析预备上传响应，提取关键参数
-	var initResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &initResp); err != nil {
-		return nil, fmt.Errorf("failed to parse upload init response: %w", err)
-	}
-	// 校验预备上传接口返回状态
-	if code, ok := initResp["code"].(float64); ok && int64(code) != 200 {
-		message := getStringValue(initResp["msg"])
-		if message == "" {
-			message = getStringValue(initResp["message"])
-		}
-		return nil, fmt.Errorf("init upload API error: code=%d, message=%s", int64(code), message)
-	}
-
-	// 提取预备上传返回的核心参数
-	data, _ := initResp["data"].(map[string]interface{})
-	csrfToken := getStringValue(data["csrf_token"])
-	fileKey := getStringValue(data["file_key"])
-	uploadURL := getStringValue(data["upload_url"])
-
-	// 校验核心参数完整性
-	if csrfToken == "" || fileKey == "" || uploadURL == "" {
-		return nil, fmt.Errorf("missing required params from init response: csrf_token=%s, file_key=%s, upload_url=%s", csrfToken, fileKey, uploadURL)
-	}
-
-	// 3. 向预备接口返回的 upload_url 上传文件内容
-	uploadResp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("X-CSRF-Token", csrfToken).
-		SetBody(tempFile).
-		Put(uploadURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to upload file to %s: %w", uploadURL, err)
-	}
-	if uploadResp.StatusCode() < 200 || uploadResp.StatusCode() >= 300 {
-		return nil, fmt.Errorf("file upload failed with status %d: %s", uploadResp.StatusCode(), uploadResp.String())
-	}
-
-	// 4. 调用完成上传接口（ok_upload）
-	completeURL := "https://pan.szczk.top/czkapi/ok_upload"
-	completePayload := &bytes.Buffer{}
-	completeWriter := multipart.NewWriter(completePayload)
-	_ = completeWriter.WriteField("hash", md5Hash)
-	_ = completeWriter.WriteField("filename", file.GetName())
-	_ = completeWriter.WriteField("filesize", fmt.Sprintf("%d", file.GetSize()))
-	_ = completeWriter.WriteField("csrf_token", csrfToken)
-	_ = completeWriter.WriteField("file_key", fileKey)
-	_ = completeWriter.WriteField("folder", dstDir.GetID())
-	if err := completeWriter.Close(); err != nil {
-		return nil, fmt.Errorf("failed to create complete upload form: %w", err)
-	}
-
-	completeResp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.AccessToken).
-		SetHeader("Content-Type", completeWriter.FormDataContentType()).
-		SetBody(completePayload.Bytes()).
-		Post(completeURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send complete upload request: %w", err)
-	}
-	if completeResp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to complete upload with status %d: %s", completeResp.StatusCode(), completeResp.String())
-	}
-
-	// 解析完成上传响应（新增 file_id 提取逻辑）
-	var completeRespData map[string]interface{}
-	if err := json.Unmarshal(completeResp.Body(), &completeRespData); err != nil {
-		return nil, fmt.Errorf("failed to parse upload complete response: %w", err)
-	}
-	// 校验完成上传接口返回状态
-	if code, ok := completeRespData["code"].(float64); ok && int64(code) != 200 {
-		message := getStringValue(completeRespData["msg"])
-		if message == "" {
-			message = getStringValue(completeRespData["message"])
-		}
-		return nil, fmt.Errorf("complete upload API error: code=%d, message=%s", int64(code), message)
-	}
-
-	// 提取 file_id（响应中为数字，转换为字符串）
-	completeData, _ := completeRespData["data"].(map[string]interface{})
-	fileID := ""
-	if fid, ok := completeData["file_id"].(float64); ok {
-		fileID = fmt.Sprintf("%.0f", fid)
-	}
-	if fileID == "" {
-		return nil, fmt.Errorf("upload succeeded but no file_id found in response")
-	}
-
-	// 5. 构建并返回包含正确ID的文件对象
-	newObj := &model.Object{
-		ID:       fileID, // 赋值从响应中提取的file_id
-		Name:     file.GetName(),
-		Size:     file.GetSize(),
-		Modified: time.Now(),
-		IsFolder: false,
-	}
-	return newObj, nil
-}
-
-func (d *CZK) GetArchiveMeta(ctx context.Context, obj model.Obj, args model.ArchiveArgs) (model.ArchiveMeta, error) {
-	return nil, errs.NotImplement
-}
-
-func (d *CZK) ListArchive(ctx context.Context, obj model.Obj, args model.ArchiveInnerArgs) ([]model.Obj, error) {
-	return nil, errs.NotImplement
-}
-
-func (d *CZK) Extract(ctx context.Context, obj model.Obj, args model.ArchiveInnerArgs) (*model.Link, error) {
-	return nil, errs.NotImplement
-}
-
-func (d *CZK) ArchiveDecompress(ctx context.Context, srcObj, dstDir model.Obj, args model.ArchiveDecompressArgs) ([]model.Obj, error) {
-	return nil, errs.NotImplement
-}
-
-func (d *CZK) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
-	return nil, errs.NotImplement
-}
-
-var _ driver.Driver = (*CZK)(nil)
-
-// getStringValue 从interface{}中安全地提取字符串值
-func getStringValue(val interface{}) string {
-	if str, ok := val.(string); ok {
-		return str
-	}
-	return ""
-}
-
-// 添加min函数以避免编译错误
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// 补充缺失的结构体定义（原代码隐含，需显式声明否则编译报错）
-type Addition struct {
-	APIKey    string // 对应原authenticate方法中的d.APIKey
-	APISecret string // 对应原authenticate方法中的d.APISecret
-}
-
-type AuthResp struct {
-	Status  int `json:"status"`
-	Message string
-	Data    struct {
-		AccessToken  string
-		RefreshToken string
-		ExpiresIn    int
-		TokenType    string
-	} `json:"data"`
-}
-
-type RefreshResp struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Success bool   `json:"success"`
-	Data    struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token,omitempty"`
-		ExpiresIn    int    `json:"expires_in"`
-		TokenType    string `json:"token_type"`
-	} `json:"data"`
-}
+package czk
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+type CZK struct {
+	model.Storage
+	Addition
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	// 保证同一时间只有一个协程刷新令牌，后端在刷新令牌轮换后会使旧的刷新令牌失效
+	tokenMu sync.Mutex
+	client  *resty.Client
+	// 发送文件内容的客户端，超时时间较长，未初始化时使用 client
+	uploadClient *resty.Client
+	// 后端拒绝过gzip压缩的请求体(415)后不再压缩
+	gzipRejected atomic.Bool
+	// 上次完整认证以来的令牌刷新次数
+	refreshCount int
+	// 后台保持令牌有效的协程，未开启 KeepTokenWarm 时为nil
+	warmerCancel context.CancelFunc
+	warmerDone   chan struct{}
+	// 开启 DedupLogs 时用于合并重复日志
+	logs dedupLogger
+	// 维护模式冷却结束的时间（UnixNano），冷却期间的请求直接返回 ErrMaintenance
+	maintenanceUntil atomic.Int64
+	// 连续失败的请求数，达到 UnhealthyAfter 后 unhealthy 被置位，直到下一次成功的请求
+	consecutiveFailures atomic.Int64
+	unhealthy           atomic.Bool
+	// 已探测到后端缺少的可选接口，键为接口名
+	missingCaps sync.Map
+	// DetectMimeViaHead 探测到的内容类型，键为文件ID
+	mimeTypes sync.Map
+	// Capabilities 的缓存结果
+	caps   *Capabilities
+	capsMu sync.Mutex
+	// 配置了 CACertPEM 时信任的根证书（系统证书加上自定义CA），为nil时使用系统默认
+	rootCAs *x509.CertPool
+	// 上传限速器，UploadRateLimitKBps 为0时为nil（不限速），同一存储的并发上传共享限额
+	uploadLimiter *rate.Limiter
+	// 代理下载限速器，DownloadRateLimitKBps 为0时为nil（不限速）
+	downloadLimiter *rate.Limiter
+	// 全局并发许可，MaxConcurrentOps 为0时为nil（不限制）
+	opSem chan struct{}
+	// 上传并发许可，MaxConcurrentUploads 为0时为nil（不限制）
+	uploadSem chan struct{}
+	// 列表和详情接口返回的对象，按ID缓存父文件夹ID和类型，itemOrder 按最近使用排序（最近的在前）
+	items     map[string]*list.Element
+	itemOrder *list.List
+	cacheMu   sync.Mutex
+}
+
+func (d *CZK) Config() driver.Config {
+	return config
+}
+
+func (d *CZK) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *CZK) Init(ctx context.Context) error {
+	// resty 在返回前读完并关闭每个响应体（驱动不使用 SetDoNotParseResponse），
+	// 非200的错误响应和上传响应也不例外，因此连接总能回到连接池复用；
+	// 限速的代理下载直接使用底层 http.Client，由调用方关闭响应体
+	if base, err := url.Parse(d.apiBase()); err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return fmt.Errorf("invalid base url %q: expect an absolute http(s) URL", d.BaseURL)
+	}
+	d.rootCAs = nil
+	if d.CACertPEM != "" {
+		pool, err := loadCACert(d.CACertPEM)
+		if err != nil {
+			return err
+		}
+		d.rootCAs = pool
+	}
+	transport := d.newTransport()
+	d.client = resty.New().SetTransport(transport).SetTimeout(requestTimeout)
+	d.installMiddleware(d.client)
+	d.configureRetry(d.client)
+	// 上传文件内容的请求耗时较长，使用单独的客户端和超时，不修改共享客户端的配置，
+	// 避免并发上传时一个上传结束后恢复超时打断另一个上传
+	d.uploadClient = resty.New().SetTransport(transport).SetTimeout(uploadTimeout).SetHeader("User-Agent", "openlist")
+	d.installMiddleware(d.uploadClient)
+	d.uploadLimiter = newRateLimiter(d.UploadRateLimitKBps)
+	d.downloadLimiter = newRateLimiter(d.DownloadRateLimitKBps)
+	d.opSem = nil
+	if d.MaxConcurrentOps > 0 {
+		d.opSem = make(chan struct{}, d.MaxConcurrentOps)
+	}
+	d.uploadSem = nil
+	if d.MaxConcurrentUploads > 0 {
+		d.uploadSem = make(chan struct{}, d.MaxConcurrentUploads)
+	}
+	// 设置全局User-Agent
+	d.client.SetHeader("User-Agent", "openlist")
+	// 获取访问令牌：优先复用上次保存的令牌，过期时使用刷新令牌换取新令牌。
+	// 存储配置中保存的令牌可能已在 Drop 时被注销（op 层会在 Drop 前后写回旧配置），
+	// 后端拒绝时先刷新，刷新失败再重新认证
+	if d.restoreTokens() {
+		if err := d.refreshTokenIfNeeded(ctx); err != nil {
+			return err
+		}
+		if err := d.checkRestoredToken(ctx); err != nil {
+			return err
+		}
+	} else if err := d.authenticate(ctx); err != nil {
+		return err
+	}
+	if d.KeepTokenWarm {
+		d.startTokenWarmer()
+	}
+	return nil
+}
+
+// Healthy 报告存储是否健康：连续 UnhealthyAfter 次请求失败后返回 false，直到有请求成功
+func (d *CZK) Healthy() bool {
+	return !d.unhealthy.Load()
+}
+
+func (d *CZK) Drop(ctx context.Context) error {
+	d.stopTokenWarmer(ctx)
+	// 注销令牌失败不影响存储卸载，吊销请求的耗时受 ctx 与 dropRevokeTimeout 共同限制
+	revokeCtx, cancel := context.WithTimeout(ctx, dropRevokeTimeout)
+	defer cancel()
+	if err := d.revokeToken(revokeCtx); err != nil {
+		d.warnf("CZK Drop: failed to revoke token: %v", err)
+	}
+	d.logs.flush()
+	return nil
+}
+
+// revokeToken 通知后端注销当前的访问令牌和刷新令牌
+func (d *CZK) revokeToken(ctx context.Context) error {
+	if d.client == nil {
+		return nil
+	}
+	d.tokenMu.Lock()
+	accessToken, refreshToken := d.AccessToken, d.RefreshToken
+	d.tokenMu.Unlock()
+	if accessToken == "" {
+		return nil
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("refresh_token", refreshToken)
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to create revoke form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("revoke_token"), writer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to send revoke request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusNotFound || resp.StatusCode() == http.StatusNotImplemented {
+		return nil
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to revoke token with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 已注销的令牌不能再复用。这里只清除内存中的配置：Drop 时 op 层可能已保存了用户修改后的配置，
+	// 或会在 Drop 之后写回旧配置，在此保存存储会覆盖前者，且对后者无效
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	d.AccessToken, d.RefreshToken = "", ""
+	d.SavedAccessToken, d.SavedRefreshToken, d.SavedTokenExpiry = "", "", 0
+	return nil
+}
+
+func (d *CZK) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	objs, err := d.listAll(ctx, dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.DetectMimeViaHead {
+		d.detectMimeTypes(ctx, objs)
+	}
+	return objs, nil
+}
+
+// listAll 获取文件夹的全部条目，query 为附加到每页请求的查询参数
+func (d *CZK) listAll(ctx context.Context, dir model.Obj, query map[string]string) ([]model.Obj, error) {
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	maxPages := d.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+	var objs []model.Obj
+	page, cursor, fetched := 1, "", 0
+	// 上一页第一个条目的ID，后端忽略分页参数反复返回同一页时据此提前终止
+	prevFirstID := ""
+	for requested := 0; ; requested++ {
+		// 后端误报分页信息时避免无限循环
+		if requested >= maxPages {
+			return nil, fmt.Errorf("list of folder %s exceeded %d pages after gathering %d items, the server is likely misreporting pagination", dir.GetID(), maxPages, len(objs))
+		}
+		listResp, err := d.listPage(ctx, backendID(dir.GetID()), page, cursor, query)
+		if err != nil {
+			return nil, err
+		}
+		data := listResp.Data
+		items := data.Items
+		if len(items) > 0 && items[0].ID != "" {
+			firstID := items[0].ID.String()
+			if requested > 0 && firstID == prevFirstID {
+				return nil, fmt.Errorf("list of folder %s returned the same page again after gathering %d items, the server is likely ignoring pagination", dir.GetID(), len(objs))
+			}
+			prevFirstID = firstID
+		}
+		fetched += len(items)
+		for _, item := range items {
+			if obj := d.parseListItem(item); obj != nil {
+				obj.ParentID = dir.GetID()
+				// 填充相对于根目录的路径，便于搜索、Glob等依赖路径的功能直接使用
+				if setter, ok := model.Obj(obj).(model.SetPath); ok {
+					setter.SetPath(path.Join("/", dir.GetPath(), obj.GetName()))
+				}
+				d.cacheItem(obj)
+				objs = append(objs, obj)
+			}
+		}
+		// 后端可能使用游标分页(next_cursor)、has_more标记或页码分页(total_count)，根据响应判断
+		if data.NextCursor != nil {
+			next := *data.NextCursor
+			if next == "" {
+				break
+			}
+			if next == cursor {
+				return nil, fmt.Errorf("list of folder %s returned the same cursor %q again after gathering %d items", dir.GetID(), cursor, len(objs))
+			}
+			cursor = next
+			continue
+		}
+		if data.HasMore != nil {
+			if !*data.HasMore || len(items) == 0 {
+				break
+			}
+			page++
+			continue
+		}
+		totalCount, ok := numberValue(data.TotalCount)
+		if !ok || len(items) == 0 || int64(fetched) >= totalCount {
+			break
+		}
+		page++
+	}
+	log.Printf("CZK List: successfully listed %d files", len(objs))
+	return objs, nil
+}
+
+// listPage 获取文件夹的一页列表
+// cursor 不为空时使用游标分页，否则使用页码分页
+func (d *CZK) listPage(ctx context.Context, folderID string, page int, cursor string, query map[string]string) (*ListResp, error) {
+	// 根据API文档，文件列表接口需要在URL中包含folder_id参数，并在请求头中携带Authorization
+	req := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParams(query).
+		SetQueryParam("folder_id", folderID)
+	if d.IncludeTrashed {
+		req.SetQueryParam("include_trashed", "1")
+	}
+	if cursor != "" {
+		req.SetQueryParam("cursor", cursor)
+	} else {
+		pageSize := d.PageSize
+		if pageSize <= 0 {
+			pageSize = defaultPageSize
+		}
+		req.SetQueryParams(map[string]string{
+			"page":      strconv.Itoa(page),
+			"page_size": strconv.Itoa(pageSize),
+		})
+	}
+	resp, err := req.Get(d.apiURL("list_files"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send list request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to list files with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应并返回文件列表
+	// 根据API示例，正确的结构是 {code, message, data: {items: [], total_count}}
+	var listResp ListResp
+	if err := decodeJSON(resp.Body(), &listResp); err != nil {
+		d.warnf("CZK List: failed to parse file list response: %v, response body: %s", err, string(resp.Body()))
+		return nil, fmt.Errorf("failed to parse file list response: %w", err)
+	}
+	// 记录响应内容用于调试
+	log.Printf("CZK List response: %+v", listResp)
+	// 检查响应中是否有错误信息
+	if code, message, failed := listResp.failed(); failed {
+		return nil, fmt.Errorf("list files API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	return &listResp, nil
+}
+
+// parseListItem 将列表中的一个条目转换为对象，条目需要被跳过时返回nil
+func (d *CZK) parseListItem(item Item) *Object {
+	id := item.ID.String()
+	name := d.normalizeName(item.Name)
+	if name == "" {
+		if d.NamelessItem != "placeholder" {
+			d.warnf("CZK List: warning - skipping item without name, id: %s", id)
+			return nil
+		}
+		name = "unnamed_" + id
+		d.warnf("CZK List: warning - item %s has no name, using placeholder %s", id, name)
+	}
+	if item.Trashed {
+		if !d.IncludeTrashed {
+			return nil
+		}
+		name = trashedPrefix + name
+	}
+	size, _ := numberValue(item.Size)
+	isFolder := item.Type == "folder"
+	// 文件夹使用创建时间，文件使用上传时间
+	modifiedStr := item.UploadedAt
+	if isFolder {
+		modifiedStr = item.CreatedAt
+	}
+	// 解析修改时间，格式为 "2025-06-29 15:37:01"，缺失或无法解析时使用当前时间
+	modified := time.Now()
+	if t, err := time.Parse("2006-01-02 15:04:05", modifiedStr); err == nil {
+		modified = t
+	}
+	// 时钟偏差或错误数据可能导致修改时间晚于当前时间，按需截断到当前时间
+	if d.ClampFutureTimes && modified.After(time.Now().Add(futureTimeAllowance)) {
+		d.warnf("CZK List: warning - item %s has a future modified time %s, clamping to now", id, modifiedStr)
+		modified = time.Now()
+	}
+	// 列表条目可能携带内容哈希（hash 与上传接口一致为MD5），用于跨存储复制时秒传
+	hashes := map[*utils.HashType]string{}
+	if item.MD5 != "" {
+		hashes[utils.MD5] = item.MD5
+	} else if item.Hash != "" {
+		hashes[utils.MD5] = item.Hash
+	}
+	if item.SHA1 != "" {
+		hashes[utils.SHA1] = item.SHA1
+	}
+	if item.SHA256 != "" {
+		hashes[utils.SHA256] = item.SHA256
+	}
+	obj := &Object{
+		Object: model.Object{
+			ID:       d.localID(id, isFolder),
+			Name:     name,
+			Size:     size,
+			Modified: modified,
+			IsFolder: isFolder,
+			HashInfo: utils.NewHashInfoByMap(hashes),
+		},
+		ETag:              item.ETag,
+		Trashed:           item.Trashed,
+		Note:              item.Note,
+		MimeType:          item.MimeType,
+		PasswordProtected: item.PasswordProtected,
+	}
+	// 预览地址可能是相对路径，无法解析时当作没有预览
+	if item.PreviewURL != "" {
+		if previewURL, err := d.absoluteURL(item.PreviewURL); err == nil {
+			obj.PreviewURL = previewURL
+		}
+	}
+	// 团队共享等文件夹可能设置了容量上限
+	if isFolder {
+		if quota, ok := numberValue(item.FolderQuota); ok {
+			obj.FolderQuota = quota
+		} else if quota, ok := numberValue(item.MaxSize); ok {
+			obj.FolderQuota = quota
+		}
+		if used, ok := numberValue(item.UsedSize); ok {
+			obj.FolderUsed = used
+		} else {
+			obj.FolderUsed = size
+		}
+		// 树形视图据此决定是否显示展开箭头，无需列出文件夹内容
+		if count, ok := numberValue(item.ChildCount); ok {
+			hasChildren := count > 0
+			obj.ChildCount, obj.HasChildren = count, &hasChildren
+		} else if item.HasChildren != nil {
+			obj.HasChildren = item.HasChildren
+		}
+	}
+	return obj
+}
+
+func (d *CZK) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	// 断点续传时从请求的Range中取得起始偏移，作为提示传给下载链接接口；
+	// 偏移只是提示，无法解析、包含多个区间或文件大小未知时忽略，从头获取链接
+	rangeHeader := ""
+	var offset int64
+	if args.Header != nil {
+		rangeHeader = args.Header.Get("Range")
+	}
+	if rangeHeader != "" {
+		if ranges, err := http_range.ParseRange(rangeHeader, file.GetSize()); err == nil && len(ranges) == 1 {
+			offset = ranges[0].Start
+		}
+	}
+	// 根据API文档，下载链接接口需要添加Authorization认证头部
+	url := d.apiURL("get_download_url") + "?file_id=" + backendID(file.GetID())
+	var resp *resty.Response
+	for attempt := 0; ; attempt++ {
+		token := d.accessToken()
+		req := d.client.R().
+			SetContext(ctx).
+			SetHeader("Authorization", "Bearer "+token)
+		if offset > 0 {
+			req.SetQueryParam("offset", strconv.FormatInt(offset, 10))
+		}
+		resp, err = req.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send get download link request: %w", err)
+		}
+		// 部分情况下令牌刚过期时接口返回403而不是401，根据响应体区分令牌过期与真正的无权限
+		if attempt > 0 || !d.RefreshOnLinkForbidden || resp.StatusCode() != http.StatusForbidden || !tokenExpiredBody(resp.Body()) {
+			break
+		}
+		log.Printf("CZK Link: download link rejected with an expired token, refreshing and retrying")
+		if err = d.renewToken(ctx, "CZK Link", token); err != nil {
+			return nil, fmt.Errorf("failed to renew expired token: %w", err)
+		}
+	}
+	if resp.StatusCode() != http.StatusOK {
+		// 非200响应体中的业务错误信息比状态码更具体，优先返回
+		var errResp map[string]interface{}
+		if decodeJSON(resp.Body(), &errResp) == nil {
+			if code, message, failed := envelopeError(errResp); failed {
+				return nil, fmt.Errorf("get download link API error with status %d: code=%d, message=%s%s", resp.StatusCode(), code, message, traceSuffix(resp))
+			}
+		}
+		return nil, fmt.Errorf("failed to get download link with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应并返回下载链接
+	var downloadResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &downloadResp); err != nil {
+		d.warnf("CZK Link: failed to parse download link response: %v, response body: %s", err, string(resp.Body()))
+		return nil, fmt.Errorf("failed to parse download link response: %w", err)
+	}
+	// 记录响应内容用于调试
+	log.Printf("CZK Link response: %+v", downloadResp)
+	// 检查响应中是否有错误信息
+	if code, message, failed := envelopeError(downloadResp); failed {
+		return nil, fmt.Errorf("get download link API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	// 从响应中提取下载链接
+	var downloadLink string
+	if data, ok := downloadResp["data"].(map[string]interface{}); ok {
+		// 尝试从不同字段获取下载链接
+		if link, ok := data["download_link"].(string); ok && link != "" {
+			downloadLink = link
+		} else if url, ok := data["url"].(string); ok && url != "" {
+			downloadLink = url
+		}
+	}
+	// 根据API文档，响应可能为空对象，这种情况下我们记录警告但不报错
+	if downloadLink == "" {
+		d.warnf("CZK Link: warning - no download link found in response: %+v", downloadResp)
+		return nil, fmt.Errorf("failed to get download link from response")
+	}
+	// 后端可能返回以 / 开头的相对路径，需要拼接API主机
+	downloadLink, err = d.absoluteURL(downloadLink)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download link: %w", err)
+	}
+	// 创建一个带有重试机制的链接
+	link := &model.Link{
+		URL:    downloadLink,
+		Header: d.downloadHeader(downloadLink),
+	}
+	// 保留原始Range，使下载主机从断点处继续传输
+	if rangeHeader != "" {
+		link.Header.Set("Range", rangeHeader)
+	}
+	// 下载经由本机代理时使用限速的读取器，重定向下载仍直接使用URL
+	if d.downloadLimiter != nil {
+		link.RangeReader = d.throttledRangeReader(link)
+	}
+	if d.WarmDownloadLink {
+		go d.warmLink(ctx, link)
+	}
+	return link, nil
+}
+
+// Capabilities 查询后端支持的可选功能，结果在驱动的生命周期内缓存
+// 后端没有功能列表接口时，根据已探测到缺失的接口推断，未探测过的功能视为支持
+func (d *CZK) Capabilities(ctx context.Context) (Capabilities, error) {
+	d.capsMu.Lock()
+	defer d.capsMu.Unlock()
+	if d.caps != nil {
+		return *d.caps, nil
+	}
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer release()
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return Capabilities{}, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		Get(d.apiURL("features"))
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to send features request: %w", err)
+	}
+	var caps Capabilities
+	if d.probeUnsupported("features", resp) {
+		caps = Capabilities{
+			Copy:            !d.unsupported("copy_item"),
+			Search:          true,
+			OfflineDownload: true,
+			Archive:         !d.unsupported("list_archive"),
+			Share:           true,
+		}
+	} else {
+		if resp.StatusCode() != http.StatusOK {
+			return Capabilities{}, fmt.Errorf("failed to get features with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+		}
+		var featuresResp FeaturesResp
+		if err := decodeJSON(resp.Body(), &featuresResp); err != nil {
+			return Capabilities{}, fmt.Errorf("failed to parse features response: %w", err)
+		}
+		if featuresResp.Code != 200 {
+			return Capabilities{}, fmt.Errorf("features API error: code=%d, message=%s%s", featuresResp.Code, featuresResp.Msg, traceSuffix(resp))
+		}
+		caps = featuresResp.Data
+		// 后端声明不支持的功能无需再探测对应接口
+		if !caps.Copy {
+			d.missingCaps.Store("batch_copy", struct{}{})
+			d.missingCaps.Store("copy_item", struct{}{})
+		}
+		if !caps.Archive {
+			d.missingCaps.Store("list_archive", struct{}{})
+			d.missingCaps.Store("extract_file", struct{}{})
+			d.missingCaps.Store("decompress", struct{}{})
+		}
+	}
+	d.caps = &caps
+	return caps, nil
+}
+
+// FolderDownloadLink 获取由后端将整个文件夹打包成zip的下载链接，后端不支持打包下载时返回 errs.NotSupport
+func (d *CZK) FolderDownloadLink(ctx context.Context, dir model.Obj) (*model.Link, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	if d.unsupported("folder_zip") {
+		return nil, errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParam("folder_id", backendID(dir.GetID())).
+		Get(d.apiURL("folder_zip"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send folder zip request: %w", err)
+	}
+	if d.probeUnsupported("folder_zip", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get folder zip link with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var zipResp FolderZipResp
+	if err := decodeJSON(resp.Body(), &zipResp); err != nil {
+		return nil, fmt.Errorf("failed to parse folder zip response: %w", err)
+	}
+	if zipResp.Code != 200 {
+		return nil, fmt.Errorf("folder zip API error: code=%d, message=%s%s", zipResp.Code, zipResp.Msg, traceSuffix(resp))
+	}
+	if zipResp.Data.DownloadLink == "" {
+		return nil, fmt.Errorf("failed to get folder zip link from response")
+	}
+	downloadLink, err := d.absoluteURL(zipResp.Data.DownloadLink)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder zip link: %w", err)
+	}
+	// 打包链接通常比单文件链接更快过期，接口未返回有效期时使用较短的默认值
+	expiration := defaultZipLinkExpiration
+	if zipResp.Data.ExpiresIn > 0 {
+		expiration = time.Duration(zipResp.Data.ExpiresIn) * time.Second
+	}
+	return &model.Link{
+		URL:        downloadLink,
+		Header:     d.downloadHeader(downloadLink),
+		Expiration: &expiration,
+	}, nil
+}
+
+func (d *CZK) authenticate(ctx context.Context) error {
+	url := d.apiURL("authenticate")
+	// 检查API密钥和密钥是否已设置
+	if d.APIKey == "" || d.APISecret == "" {
+		return fmt.Errorf("API key or secret not set")
+	}
+	// 根据API文档，认证接口需要在请求头中包含x-api-key和x-api-secret
+	var resp *resty.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = d.client.R().
+			SetContext(ctx).
+			SetHeader("x-api-key", d.APIKey).
+			SetHeader("x-api-secret", d.APISecret).
+			Get(url)
+		if err != nil {
+			return fmt.Errorf("failed to send auth request: %w", err)
+		}
+		// 认证接口被限流(429)时退避重试，其余状态码直接处理
+		if resp.StatusCode() != http.StatusTooManyRequests || attempt >= authMaxRetries {
+			break
+		}
+		wait := retryAfter(resp, authRetryBaseDelay<<attempt)
+		d.warnf("CZK authenticate: rate limited (429), retrying in %v (attempt %d/%d)", wait, attempt+1, authMaxRetries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("authentication rate limited: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+	if resp.StatusCode() == http.StatusUnauthorized || resp.StatusCode() == http.StatusForbidden {
+		return fmt.Errorf("authentication rejected with status %d, check API key and secret: %s", resp.StatusCode(), string(resp.Body()))
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("authentication failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
+	}
+	// 解析认证响应，获取access_token, refresh_token等
+	var authResp AuthResp
+	if err := decodeJSON(resp.Body(), &authResp); err != nil {
+		d.warnf("CZK authenticate: failed to parse auth response: %v, response body: %s", err, string(resp.Body()))
+		return fmt.Errorf("failed to parse auth response: %w, response body: %s", err, string(resp.Body()))
+	}
+	// 检查API返回的状态码
+	// 根据经验，即使status不是200，但如果message是"认证成功"，我们也认为认证成功
+	if authResp.Status != 200 && authResp.Message != "认证成功" {
+		return fmt.Errorf("authentication API error: status=%d, message=%s%s", authResp.Status, authResp.Message, traceSuffix(resp))
+	}
+	// 检查是否获得了必要的令牌，需在截取令牌前缀记录日志之前完成
+	if authResp.Data.AccessToken == "" {
+		return fmt.Errorf("authentication succeeded but no access token returned")
+	}
+	if authResp.Data.RefreshToken == "" {
+		return fmt.Errorf("authentication succeeded but no refresh token returned")
+	}
+	// 记录响应内容用于调试
+	log.Printf("CZK authenticate response: Status=%d, Message=%s, Data.AccessToken=%s***, Data.RefreshToken=%s***, Data.ExpiresIn=%d, Data.TokenType=%s",
+		authResp.Status, authResp.Message,
+		authResp.Data.AccessToken[:min(len(authResp.Data.AccessToken), 10)],
+		authResp.Data.RefreshToken[:min(len(authResp.Data.RefreshToken), 10)],
+		authResp.Data.ExpiresIn, authResp.Data.TokenType)
+	// 更新令牌信息
+	d.AccessToken = authResp.Data.AccessToken
+	d.RefreshToken = authResp.Data.RefreshToken
+	d.ExpiresAt = time.Now().Add(time.Duration(authResp.Data.ExpiresIn) * time.Second)
+	d.refreshCount = 0
+	d.saveTokens()
+	log.Printf("CZK authenticate: successfully authenticated, access token: %s***, refresh token: %s***, expires at: %v",
+		d.AccessToken[:min(len(d.AccessToken), 10)], d.RefreshToken[:min(len(d.RefreshToken), 10)], d.ExpiresAt)
+	return nil
+}
+
+func (d *CZK) refreshTokenIfNeeded(ctx context.Context) error {
+	// 持有锁后再检查过期时间，等待期间其他协程完成刷新时直接使用新令牌
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	if time.Now().After(d.ExpiresAt) {
+		// 刷新令牌不轮换时可能长期不变，刷新次数达到上限后重新进行完整认证
+		if d.ReauthAfterRefreshes > 0 && d.refreshCount >= d.ReauthAfterRefreshes {
+			log.Printf("CZK refreshTokenIfNeeded: %d refreshes since last authentication, re-authenticating", d.refreshCount)
+			return d.authenticate(ctx)
+		}
+		// 尝试刷新令牌
+		err := d.refreshToken()
+		if err != nil {
+			// 如果刷新令牌失败，尝试重新认证
+			d.warnf("Failed to refresh token: %v, attempting to re-authenticate", err)
+			return d.authenticate(ctx)
+		}
+	}
+	return nil
+}
+
+// renewToken 刷新令牌，刷新失败时重新认证，同一时间只有一个协程执行
+// stale 为调用方被拒绝的访问令牌，等待锁期间其他协程已换发新令牌时直接复用，不再重复刷新
+func (d *CZK) renewToken(ctx context.Context, caller, stale string) error {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	if d.AccessToken != stale {
+		return nil
+	}
+	if err := d.refreshToken(); err != nil {
+		d.warnf("%s: failed to refresh token: %v, attempting to re-authenticate", caller, err)
+		return d.authenticate(ctx)
+	}
+	return nil
+}
+
+// refreshToken 使用刷新令牌换取新的访问令牌，调用方需持有 tokenMu
+func (d *CZK) refreshToken() error {
+	url := d.apiURL("refresh_token")
+	// 检查是否有有效的刷新令牌
+	if d.RefreshToken == "" {
+		// 如果没有刷新令牌，需要重新进行认证
+		return fmt.Errorf("no refresh token available, need to re-authenticate")
+	}
+	log.Printf("CZK refreshToken: attempting to refresh token with refresh token: %s***", d.RefreshToken[:min(len(d.RefreshToken), 10)])
+	// 创建表单数据，根据API文档，只需要refresh_token字段
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("refresh_token", d.RefreshToken)
+	err := writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token form: %w", err)
+	}
+	// 根据API文档，刷新令牌接口使用POST方法，请求体使用multipart/form-data格式
+	resp, err := d.client.R().
+		SetHeader("Content-Type", writer.FormDataContentType()).
+		SetBody(payload.Bytes()).
+		Post(url)
+	if err != nil {
+		return fmt.Errorf("failed to send refresh request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		d.warnf("CZK refreshToken: refresh request failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
+		return fmt.Errorf("token refresh failed with status %d: %s, response body: %s", resp.StatusCode(), resp.Status(), string(resp.Body()))
+	}
+	// 解析刷新令牌响应，更新access_token等
+	var refreshResp RefreshResp
+	if err := decodeJSON(resp.Body(), &refreshResp); err != nil {
+		d.warnf("CZK refreshToken: failed to parse refresh response: %v, response body: %s", err, string(resp.Body()))
+		return fmt.Errorf("failed to parse refresh response: %w, response body: %s", err, string(resp.Body()))
+	}
+	// 检查API返回的状态码和成功标志
+	// 当Success为true且Status为200时，表示刷新成功
+	if !refreshResp.Success || refreshResp.Status != 200 {
+		// 特别处理"需要提供刷新令牌"和"无效或过期的刷新令牌"的错误
+		if refreshResp.Message == "需要提供刷新令牌" || refreshResp.Message == "无效或过期的刷新令牌" {
+			return fmt.Errorf("token refresh API error: status=%d, success=%t, message=%s, refresh token may be invalid or expired%s", refreshResp.Status, refreshResp.Success, refreshResp.Message, traceSuffix(resp))
+		}
+		return fmt.Errorf("token refresh API error: status=%d, success=%t, message=%s%s", refreshResp.Status, refreshResp.Success, refreshResp.Message, traceSuffix(resp))
+	}
+	// 检查是否获得了新的访问令牌，需在截取令牌前缀记录日志之前完成
+	if refreshResp.Data.AccessToken == "" {
+		return fmt.Errorf("token refresh succeeded but no access token returned")
+	}
+	// 记录响应内容用于调试
+	log.Printf("CZK refreshToken response: Status=%d, Message=%s, Success=%t, Data.AccessToken=%s***, Data.ExpiresIn=%d, Data.TokenType=%s",
+		refreshResp.Status, refreshResp.Message, refreshResp.Success,
+		refreshResp.Data.AccessToken[:min(len(refreshResp.Data.AccessToken), 10)],
+		refreshResp.Data.ExpiresIn, refreshResp.Data.TokenType)
+	// 更新访问令牌和过期时间
+	d.AccessToken = refreshResp.Data.AccessToken
+	d.ExpiresAt = time.Now().Add(time.Duration(refreshResp.Data.ExpiresIn) * time.Second)
+	d.refreshCount++
+	// 如果返回了新的刷新令牌，则更新它
+	if refreshResp.Data.RefreshToken != "" {
+		d.RefreshToken = refreshResp.Data.RefreshToken
+		log.Printf("CZK refreshToken: new refresh token received and updated: %s***", d.RefreshToken[:min(len(d.RefreshToken), 10)])
+	}
+	d.saveTokens()
+	log.Printf("CZK refreshToken: successfully refreshed token, access token: %s***, expires at: %v",
+		d.AccessToken[:min(len(d.AccessToken), 10)], d.ExpiresAt)
+	return nil
+}
+
+// 以下方法为可选实现
+func (d *CZK) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !parentDir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	dirName = d.normalizeName(dirName)
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	url := d.apiURL("create_folder")
+	// 创建表单数据
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("parent_id", backendID(parentDir.GetID()))
+	_ = writer.WriteField("name", dirName)
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mkdir form: %w", err)
+	}
+	resp, err := d.postForm(d.withIdempotencyKey(ctx), url, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send mkdir request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusConflict {
+		return d.existingFolder(ctx, parentDir, dirName, fmt.Errorf("failed to create folder with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp)))
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to create folder with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse create folder response: %w", err)
+	}
+	// 检查响应中是否有错误信息
+	if code, message, failed := envelopeError(operationResp); failed {
+		apiErr := fmt.Errorf("create folder API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+		if code == http.StatusConflict {
+			return d.existingFolder(ctx, parentDir, dirName, apiErr)
+		}
+		return nil, apiErr
+	}
+	// 从响应中提取新创建的文件夹ID
+	folderID := ""
+	if data, ok := operationResp["data"].(map[string]interface{}); ok {
+		if id, ok := data["folder_id"].(float64); ok {
+			folderID = fmt.Sprintf("%.0f", id)
+		}
+	}
+	// 返回新创建的目录对象
+	newObj := &model.Object{
+		ID:       d.localID(folderID, true),
+		Name:     dirName,
+		Size:     0,
+		Modified: time.Now(),
+		IsFolder: true,
+	}
+	return newObj, nil
+}
+
+// existingFolder 处理同名文件夹已存在的情况（通常是并发创建的竞争），
+// 开启 ReuseExistingFolder 时以后端列表为准返回已存在的文件夹，否则返回 createErr
+func (d *CZK) existingFolder(ctx context.Context, parentDir model.Obj, dirName string, createErr error) (model.Obj, error) {
+	if !d.ReuseExistingFolder {
+		return nil, createErr
+	}
+	objs, err := d.listAll(ctx, parentDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w (failed to re-list parent folder: %v)", createErr, err)
+	}
+	for _, obj := range objs {
+		if obj.IsDir() && obj.GetName() == dirName {
+			log.Printf("CZK MakeDir: folder %s already exists in %s, reusing %s", dirName, parentDir.GetID(), obj.GetID())
+			return obj, nil
+		}
+	}
+	return nil, createErr
+}
+
+func (d *CZK) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dstDir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	// 已知对象就在目标文件夹中时无需请求后端
+	if parentID, ok := d.parentOf(srcObj); ok && parentID == dstDir.GetID() {
+		return srcObj, nil
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	url := d.apiURL("move_item")
+	// 创建表单数据，根据API示例使用正确的参数名
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(srcObj.GetID()))
+	_ = writer.WriteField("type", itemType(srcObj))
+	// 根据API规范，目标目录ID使用target_id参数名
+	_ = writer.WriteField("target_id", backendID(dstDir.GetID()))
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create move form: %w", err)
+	}
+	// 根据POST接口调用规范，需要在请求头中携带Authorization认证信息
+	resp, err := d.postForm(ctx, url, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send move request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to move item with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse move response: %w", err)
+	}
+	// 检查响应中是否有错误信息
+	if code, message, failed := envelopeError(operationResp); failed {
+		return nil, fmt.Errorf("move item API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	// 根据API示例响应格式解析返回的数据
+	// 示例: {"code": 200, "msg": "成功", "data": {"items": [...]}}
+	newObj := &Object{
+		Object: model.Object{
+			ID:       srcObj.GetID(),
+			Name:     srcObj.GetName(),
+			Size:     srcObj.GetSize(),
+			Modified: time.Now(),
+			IsFolder: srcObj.IsDir(),
+		},
+		ParentID: dstDir.GetID(),
+	}
+	// 从响应中提取更新后的对象信息
+	if data, ok := operationResp["data"].(map[string]interface{}); ok {
+		if items, ok := data["items"].([]interface{}); ok && len(items) > 0 {
+			// 查找被移动的对象
+			for _, itemData := range items {
+				if itemMap, ok := itemData.(map[string]interface{}); ok {
+					if id, ok := itemMap["id"].(float64); ok && fmt.Sprintf("%.0f", id) == backendID(srcObj.GetID()) {
+						// 找到被移动的对象，更新信息
+						if name, ok := itemMap["name"].(string); ok {
+							newObj.Name = name
+						}
+						// parent_id 是新的父目录ID
+						if parentID, ok := itemMap["parent_id"].(float64); ok {
+							newObj.ParentID = d.localID(fmt.Sprintf("%.0f", parentID), true)
+						}
+						if createdAt, ok := itemMap["created_at"].(string); ok {
+							if t, err := time.Parse("2006-01-02 15:04:05", createdAt); err == nil {
+								newObj.Modified = t
+							}
+						}
+						break
+					}
+				}
+			}
+		}
+	}
+	if dstDir.GetPath() != "" {
+		newObj.Path = path.Join(dstDir.GetPath(), newObj.Name)
+	}
+	// 文件夹移动后其下所有条目的路径都已改变，清除整个子树的缓存
+	if srcObj.IsDir() {
+		d.invalidateSubtree(srcObj.GetPath())
+	}
+	d.cacheItem(newObj)
+	return newObj, nil
+}
+
+// Copy 在服务端将对象复制到 dstDir，文件夹由后端一次递归复制，无需下载后重新上传。
+// 后端不支持复制接口时返回 errs.NotSupport，由上层回退为下载后上传
+func (d *CZK) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dstDir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	newObj, err := d.copyItem(ctx, srcObj, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if dstDir.GetPath() != "" {
+		newObj.Path = path.Join(dstDir.GetPath(), newObj.Name)
+	}
+	return newObj, nil
+}
+
+func (d *CZK) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	newName = d.normalizeName(newName)
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	url := d.apiURL("rename_item")
+	// 创建表单数据
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(srcObj.GetID()))
+	_ = writer.WriteField("type", itemType(srcObj))
+	_ = writer.WriteField("new_name", newName)
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rename form: %w", err)
+	}
+	resp, err := d.postForm(ctx, url, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send rename request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to rename item with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse rename response: %w", err)
+	}
+	// 检查响应中是否有错误信息
+	if code, message, failed := envelopeError(operationResp); failed {
+		return nil, fmt.Errorf("rename item API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	// 返回更新后的对象
+	// 注意：这里应该根据实际API响应来构建对象
+	// 目前我们简单地复制原对象并更新名称
+	newObj := &model.Object{
+		ID:       srcObj.GetID(),
+		Name:     newName,
+		Size:     srcObj.GetSize(),
+		Modified: time.Now(),
+		IsFolder: srcObj.IsDir(),
+	}
+	return newObj, nil
+}
+
+func (d *CZK) Remove(ctx context.Context, obj model.Obj) error {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = d.deleteItem(ctx, obj)
+	return err
+}
+
+// TrashAndTrack 将对象移入回收站并返回回收站条目ID，便于之后精确恢复
+func (d *CZK) TrashAndTrack(ctx context.Context, obj model.Obj) (trashID string, err error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	data, err := d.deleteItem(ctx, obj)
+	if err != nil {
+		return "", err
+	}
+	if id, ok := data["trash_id"].(float64); ok {
+		trashID = fmt.Sprintf("%.0f", id)
+	} else {
+		trashID = getStringValue(data["trash_id"])
+	}
+	if trashID == "" {
+		return "", fmt.Errorf("item %s was deleted but no trash_id found in response", obj.GetID())
+	}
+	return trashID, nil
+}
+
+// deleteItem 调用删除接口（移入回收站），返回响应中的data部分
+func (d *CZK) deleteItem(ctx context.Context, obj model.Obj) (map[string]interface{}, error) {
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	url := d.apiURL("delete_item")
+	// 创建表单数据
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(obj.GetID()))
+	_ = writer.WriteField("type", itemType(obj))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create delete form: %w", err)
+	}
+	resp, err := d.postForm(ctx, url, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send delete request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to delete item with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	// 解析响应
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse delete response: %w", err)
+	}
+	// 检查响应中是否有错误信息
+	if code, message, failed := envelopeError(operationResp); failed {
+		return nil, fmt.Errorf("delete item API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	data, _ := operationResp["data"].(map[string]interface{})
+	return data, nil
+}
+
+// Glob 递归列出 dir 下相对路径匹配 pattern 的对象
+// pattern 使用 path.Match 语法，并支持用 ** 匹配任意层级的目录，递归深度受 GlobMaxDepth 限制
+func (d *CZK) Glob(ctx context.Context, dir model.Obj, pattern string) ([]model.Obj, error) {
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	maxDepth := d.GlobMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultGlobMaxDepth
+	}
+	var matched []model.Obj
+	var walk func(dir model.Obj, prefix string, depth int) error
+	walk = func(dir model.Obj, prefix string, depth int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		objs, err := d.List(ctx, dir, model.ListArgs{})
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			rel := path.Join(prefix, obj.GetName())
+			if matchGlob(pattern, rel) {
+				matched = append(matched, obj)
+			}
+			if obj.IsDir() && depth < maxDepth {
+				if err := walk(obj, rel, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(dir, "", 1); err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// DiffTree 列出 dir 下的完整目录树，与期望的条目比较，返回缺失、多余、大小或类型不一致的条目，按路径排序
+// 每次列表都经过 List，受全局并发上限约束；文件夹的大小不参与比较，期望条目的上级文件夹视为已期望
+func (d *CZK) DiffTree(ctx context.Context, dir model.Obj, expected []TreeEntry) ([]TreeDiff, error) {
+	remote := map[string]model.Obj{}
+	var walk func(dir model.Obj, prefix string) error
+	walk = func(dir model.Obj, prefix string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		objs, err := d.List(ctx, dir, model.ListArgs{})
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			rel := path.Join(prefix, obj.GetName())
+			remote[rel] = obj
+			if obj.IsDir() {
+				if err := walk(obj, rel); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(dir, ""); err != nil {
+		return nil, err
+	}
+	var diffs []TreeDiff
+	seen := make(map[string]bool, len(expected))
+	for _, entry := range expected {
+		rel := strings.Trim(path.Clean("/"+entry.Path), "/")
+		// "/"、"" 等指向 dir 本身的条目不参与比较
+		if rel == "" {
+			continue
+		}
+		// 期望条目的上级文件夹即使没有单独列出也不算多余
+		for p := rel; p != "." && !seen[p]; p = path.Dir(p) {
+			seen[p] = true
+		}
+		obj, ok := remote[rel]
+		switch {
+		case !ok:
+			diffs = append(diffs, TreeDiff{Path: rel, Kind: DiffMissing, ExpectedSize: entry.Size})
+		case obj.IsDir() != entry.IsFolder:
+			diffs = append(diffs, TreeDiff{Path: rel, Kind: DiffTypeMismatch, ExpectedSize: entry.Size, ActualSize: obj.GetSize()})
+		case !entry.IsFolder && obj.GetSize() != entry.Size:
+			diffs = append(diffs, TreeDiff{Path: rel, Kind: DiffSizeMismatch, ExpectedSize: entry.Size, ActualSize: obj.GetSize()})
+		}
+	}
+	for rel, obj := range remote {
+		if !seen[rel] {
+			diffs = append(diffs, TreeDiff{Path: rel, Kind: DiffExtra, ActualSize: obj.GetSize()})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// Prewarm 并发预先列出一组文件夹，填充 OpenList 的列表缓存（对象带有路径时）和驱动内的对象缓存
+// 并发数受 MaxConcurrentOps 限制，未配置时使用 defaultPrewarmConcurrency
+func (d *CZK) Prewarm(ctx context.Context, dirs []model.Obj) error {
+	limit := d.MaxConcurrentOps
+	if limit <= 0 {
+		limit = defaultPrewarmConcurrency
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for _, dir := range dirs {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			var err error
+			if dir.GetPath() != "" {
+				_, err = op.List(gctx, d, dir.GetPath(), model.ListArgs{})
+			} else {
+				_, err = d.List(gctx, dir, model.ListArgs{})
+			}
+			if err != nil {
+				return fmt.Errorf("failed to prewarm folder %s: %w", dir.GetID(), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// ListPartitioned 列出文件夹内容并分为文件夹和文件两部分，各部分保持列表中的顺序
+func (d *CZK) ListPartitioned(ctx context.Context, dir model.Obj) (folders, files []model.Obj, err error) {
+	objs, err := d.List(ctx, dir, model.ListArgs{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, obj := range objs {
+		if obj.IsDir() {
+			folders = append(folders, obj)
+		} else {
+			files = append(files, obj)
+		}
+	}
+	return folders, files, nil
+}
+
+// ListMatching 列出文件夹中名称包含 substring 的条目（不区分大小写）
+// 通过 name_contains 参数请求后端过滤，后端忽略该参数时在本地完成过滤
+func (d *CZK) ListMatching(ctx context.Context, dir model.Obj, substring string) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	objs, err := d.listAll(ctx, dir, map[string]string{"name_contains": substring})
+	if err != nil {
+		return nil, err
+	}
+	needle := strings.ToLower(substring)
+	matched := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		if strings.Contains(strings.ToLower(obj.GetName()), needle) {
+			matched = append(matched, obj)
+		}
+	}
+	return matched, nil
+}
+
+// ListModifiedBetween 列出文件夹中修改时间位于 [from, to) 内的条目，from 或 to 为零值时该端不限制
+// 通过 modified_from/modified_to 参数请求后端过滤，后端忽略参数时在本地完成过滤；
+// 参数按列表解析修改时间的同一格式和时区发送，保证两种过滤方式的边界一致
+func (d *CZK) ListModifiedBetween(ctx context.Context, dir model.Obj, from, to time.Time) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	query := map[string]string{}
+	if !from.IsZero() {
+		query["modified_from"] = from.UTC().Format("2006-01-02 15:04:05")
+	}
+	if !to.IsZero() {
+		query["modified_to"] = to.UTC().Format("2006-01-02 15:04:05")
+	}
+	objs, err := d.listAll(ctx, dir, query)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		modified := obj.ModTime()
+		// 没有修改时间的条目无法判断是否在范围内，指定了范围时排除
+		if modified.IsZero() && (!from.IsZero() || !to.IsZero()) {
+			continue
+		}
+		if (!from.IsZero() && modified.Before(from)) || (!to.IsZero() && !modified.Before(to)) {
+			continue
+		}
+		matched = append(matched, obj)
+	}
+	return matched, nil
+}
+
+// FileStats 获取文件的下载统计信息，后端不支持统计接口时返回 errs.NotSupport
+func (d *CZK) FileStats(ctx context.Context, file model.Obj) (*FileStats, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.unsupported("file_stats") {
+		return nil, errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParam("file_id", backendID(file.GetID())).
+		Get(d.apiURL("file_stats"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send file stats request: %w", err)
+	}
+	if d.probeUnsupported("file_stats", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get file stats with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var statsResp FileStatsResp
+	if err = decodeJSON(resp.Body(), &statsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse file stats response: %w", err)
+	}
+	if statsResp.Code != 200 {
+		return nil, fmt.Errorf("file stats API error: code=%d, message=%s%s", statsResp.Code, statsResp.Msg, traceSuffix(resp))
+	}
+	stats := &FileStats{
+		DownloadCount: statsResp.Data.DownloadCount,
+		ShareCount:    statsResp.Data.ShareCount,
+	}
+	if statsResp.Data.LastAccessed != "" {
+		if t, err := time.Parse("2006-01-02 15:04:05", statsResp.Data.LastAccessed); err == nil {
+			stats.LastAccessed = t
+		}
+	}
+	return stats, nil
+}
+
+// GetPreviewLink 返回文件的预览链接：Office、PDF 等文档使用后端提供的在线预览地址，
+// 文档设置了打开密码时返回 ErrPasswordProtected，其他文件或没有预览地址的文档返回下载链接
+func (d *CZK) GetPreviewLink(ctx context.Context, file model.Obj) (*model.Link, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if file.IsDir() {
+		return nil, errs.NotFile
+	}
+	if !utils.SliceContains(documentExts, strings.ToLower(utils.Ext(file.GetName()))) {
+		return d.Link(ctx, file, model.LinkArgs{})
+	}
+	// 列表返回的对象已带有预览信息时无需再查询详情
+	obj, ok := file.(*Object)
+	if !ok || (obj.PreviewURL == "" && !obj.PasswordProtected) {
+		if obj, err = d.getItemInfo(ctx, file.GetID(), false); err != nil {
+			return nil, fmt.Errorf("failed to get item info: %w", err)
+		}
+	}
+	if obj.PasswordProtected {
+		return nil, fmt.Errorf("%w: %s", ErrPasswordProtected, file.GetName())
+	}
+	if obj.PreviewURL == "" {
+		return d.Link(ctx, file, model.LinkArgs{})
+	}
+	return &model.Link{URL: obj.PreviewURL}, nil
+}
+
+// ReadRange 下载文件中从 offset 开始的 length 字节并写入 w，返回写入的字节数，用于服务端转码或建立索引。
+// 下载主机不支持Range请求时返回 ErrRangeNotSupported，而不是下载整个文件
+func (d *CZK) ReadRange(ctx context.Context, file model.Obj, offset, length int64, w io.Writer) (int64, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if file.IsDir() {
+		return 0, errs.NotFile
+	}
+	if offset < 0 || length < 0 {
+		return 0, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	if length == 0 {
+		return 0, nil
+	}
+	link, err := d.Link(ctx, file, model.LinkArgs{})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header = http_range.ApplyRangeToHttpHeader(http_range.Range{Start: offset, Length: length}, link.Header.Clone())
+	resp, err := d.client.GetClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send download request: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// 请求的范围覆盖整个文件时，返回完整内容也满足要求
+		if offset > 0 || resp.ContentLength < 0 || resp.ContentLength > length {
+			return 0, fmt.Errorf("%w: requested bytes %d-%d of %s", ErrRangeNotSupported, offset, offset+length-1, file.GetName())
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, fmt.Errorf("range %d-%d is outside %s", offset, offset+length-1, file.GetName())
+	default:
+		return 0, fmt.Errorf("failed to download with status %d", resp.StatusCode)
+	}
+	n, err := io.CopyN(w, resp.Body, length)
+	if errors.Is(err, io.EOF) {
+		// 范围超出文件末尾时只返回到末尾为止的内容
+		return n, nil
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to read range: %w", err)
+	}
+	return n, nil
+}
+
+// GetShareLink 返回对象已有的第一个有效分享，没有有效分享时返回 errs.ObjectNotFound，
+// 后端不支持分享查询接口时返回 errs.NotSupport
+func (d *CZK) GetShareLink(ctx context.Context, obj model.Obj) (*ShareResult, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.unsupported("list_shares") {
+		return nil, errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParams(map[string]string{"id": backendID(obj.GetID()), "type": itemType(obj)}).
+		Get(d.apiURL("list_shares"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send list shares request: %w", err)
+	}
+	if d.probeUnsupported("list_shares", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to list shares with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var sharesResp SharesResp
+	if err = decodeJSON(resp.Body(), &sharesResp); err != nil {
+		return nil, fmt.Errorf("failed to parse list shares response: %w", err)
+	}
+	if sharesResp.Code != 200 {
+		return nil, fmt.Errorf("list shares API error: code=%d, message=%s%s", sharesResp.Code, sharesResp.Msg, traceSuffix(resp))
+	}
+	now := time.Now()
+	for _, share := range sharesResp.Data.Shares {
+		// 未返回状态的旧版本后端视为有效，再按过期时间过滤
+		if share.ShareURL == "" || (share.Status != "" && share.Status != "active") {
+			continue
+		}
+		result := &ShareResult{ID: share.ShareID.String(), Password: share.Password}
+		if result.URL, err = d.absoluteURL(share.ShareURL); err != nil {
+			return nil, fmt.Errorf("invalid share url %q: %w", share.ShareURL, err)
+		}
+		if share.ExpiresAt != "" {
+			if t, err := time.Parse("2006-01-02 15:04:05", share.ExpiresAt); err == nil {
+				if !t.After(now) {
+					continue
+				}
+				result.ExpiresAt = t
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("no active share for %s: %w", obj.GetID(), errs.ObjectNotFound)
+}
+
+// BatchThumbs 返回文件ID到缩略图地址的映射，用于预热相册视图，文件夹会被忽略。
+// 后端支持批量缩略图接口时只发送一次请求，否则逐个获取下载链接作为缩略图
+func (d *CZK) BatchThumbs(ctx context.Context, files []model.Obj) (map[string]string, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	targets := make([]model.Obj, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() {
+			targets = append(targets, file)
+		}
+	}
+	thumbs := make(map[string]string, len(targets))
+	if len(targets) == 0 {
+		return thumbs, nil
+	}
+	byBackendID, err := d.batchThumbs(ctx, targets)
+	if errors.Is(err, errs.NotSupport) {
+		for _, file := range targets {
+			link, err := d.Link(ctx, file, model.LinkArgs{})
+			if err != nil {
+				return nil, fmt.Errorf("thumbnail %s: %w", file.GetName(), err)
+			}
+			thumbs[file.GetID()] = link.URL
+		}
+		return thumbs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range targets {
+		if thumb, ok := byBackendID[backendID(file.GetID())]; ok {
+			thumbs[file.GetID()] = thumb
+		}
+	}
+	return thumbs, nil
+}
+
+// batchThumbs 调用批量缩略图接口，返回以后端ID为键的缩略图地址，接口不可用时返回 errs.NotSupport
+func (d *CZK) batchThumbs(ctx context.Context, files []model.Obj) (map[string]string, error) {
+	if d.unsupported("batch_thumbnails") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, backendID(file.GetID()))
+	}
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail ids: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("ids", string(idsJSON))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch thumbnails form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("batch_thumbnails"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch thumbnails request: %w", err)
+	}
+	if d.probeUnsupported("batch_thumbnails", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get thumbnails with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var thumbsResp BatchThumbsResp
+	if err := decodeJSON(resp.Body(), &thumbsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch thumbnails response: %w", err)
+	}
+	if thumbsResp.Code != 200 {
+		return nil, fmt.Errorf("batch thumbnails API error: code=%d, message=%s%s", thumbsResp.Code, thumbsResp.Msg, traceSuffix(resp))
+	}
+	thumbs := make(map[string]string, len(thumbsResp.Data.Thumbnails))
+	for _, thumb := range thumbsResp.Data.Thumbnails {
+		if thumb.ThumbnailURL == "" {
+			continue
+		}
+		link, err := d.absoluteURL(thumb.ThumbnailURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid thumbnail url %q: %w", thumb.ThumbnailURL, err)
+		}
+		thumbs[thumb.ID.String()] = link
+	}
+	return thumbs, nil
+}
+
+// OfflineCancel 取消正在进行的离线下载任务，并删除任务已写入的未完成文件
+// 任务已经结束时视为成功，已下载完成的文件保持不变；后端不支持离线下载时返回 errs.NotSupport
+func (d *CZK) OfflineCancel(ctx context.Context, taskID string) error {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if d.unsupported("offline_cancel") {
+		return errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("task_id", taskID)
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to create offline cancel form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("offline_cancel"), writer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to send offline cancel request: %w", err)
+	}
+	if d.probeUnsupported("offline_cancel", resp) {
+		return errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to cancel offline task with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var cancelResp OfflineCancelResp
+	if err = decodeJSON(resp.Body(), &cancelResp); err != nil {
+		return fmt.Errorf("failed to parse offline cancel response: %w", err)
+	}
+	switch cancelResp.Code {
+	case 200:
+	case offlineTaskFinishedCode:
+		log.Printf("CZK OfflineCancel: task %s already finished, nothing to cancel", taskID)
+		return nil
+	default:
+		return fmt.Errorf("offline cancel API error: code=%d, message=%s%s", cancelResp.Code, cancelResp.Msg, traceSuffix(resp))
+	}
+	if partialID := cancelResp.Data.PartialFileID.String(); partialID != "" && partialID != "0" {
+		if _, err = d.deleteItem(ctx, &model.Object{ID: partialID}); err != nil {
+			return fmt.Errorf("task %s cancelled but failed to remove partial file %s: %w", taskID, partialID, err)
+		}
+	}
+	return nil
+}
+
+// Changes 获取自游标 since 以来的变更事件（since 为空时从最早的记录开始），并返回下一次查询使用的游标
+// 后端不支持变更记录接口时返回 errs.NotSupport
+func (d *CZK) Changes(ctx context.Context, since string) ([]ChangeEvent, string, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+	if d.unsupported("changes") {
+		return nil, "", errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+	req := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer())
+	if since != "" {
+		req.SetQueryParam("cursor", since)
+	}
+	resp, err := req.Get(d.apiURL("changes"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to send changes request: %w", err)
+	}
+	if d.probeUnsupported("changes", resp) {
+		return nil, "", errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to get changes with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var changesResp ChangesResp
+	if err = decodeJSON(resp.Body(), &changesResp); err != nil {
+		return nil, "", fmt.Errorf("failed to parse changes response: %w", err)
+	}
+	if changesResp.Code != 200 {
+		return nil, "", fmt.Errorf("changes API error: code=%d, message=%s%s", changesResp.Code, changesResp.Msg, traceSuffix(resp))
+	}
+	events := make([]ChangeEvent, 0, len(changesResp.Data.Events))
+	for _, e := range changesResp.Data.Events {
+		isFolder := e.ItemType == "folder"
+		event := ChangeEvent{
+			Type:        e.Type,
+			ID:          d.localID(e.ID.String(), isFolder),
+			IsFolder:    isFolder,
+			Name:        e.Name,
+			ParentID:    d.localID(e.ParentID.String(), true),
+			OldParentID: d.localID(e.OldParentID.String(), true),
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05", e.Time); err == nil {
+			event.Time = t
+		}
+		events = append(events, event)
+	}
+	// 没有新变更时后端可能不返回游标，保持原游标
+	next := changesResp.Data.NextCursor
+	if next == "" {
+		next = since
+	}
+	return events, next, nil
+}
+
+// CopyChildren 将 srcDir 中选定的子项复制到 dstDir，返回复制得到的新对象
+// 后端支持批量复制接口时只发送一次请求，否则逐个复制；childIDs 中不属于 srcDir 的条目返回 errs.ObjectNotFound
+func (d *CZK) CopyChildren(ctx context.Context, srcDir model.Obj, childIDs []string, dstDir model.Obj) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dstDir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	children, err := d.List(ctx, srcDir, model.ListArgs{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source folder: %w", err)
+	}
+	byID := make(map[string]model.Obj, len(children))
+	for _, child := range children {
+		byID[child.GetID()] = child
+	}
+	var selected []model.Obj
+	var failed []error
+	for _, id := range childIDs {
+		child, ok := byID[id]
+		if !ok {
+			failed = append(failed, fmt.Errorf("copy %s: %w", id, errs.ObjectNotFound))
+			continue
+		}
+		selected = append(selected, child)
+	}
+	if len(selected) == 0 {
+		return nil, errors.Join(failed...)
+	}
+	var copied []model.Obj
+	results, err := d.batchCopy(ctx, selected, dstDir)
+	if errors.Is(err, errs.NotSupport) {
+		for _, src := range selected {
+			obj, err := d.copyItem(ctx, src, dstDir)
+			if err != nil {
+				failed = append(failed, fmt.Errorf("copy %s: %w", src.GetID(), err))
+				continue
+			}
+			copied = append(copied, obj)
+		}
+		return copied, errors.Join(failed...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range selected {
+		result, ok := results[backendID(src.GetID())]
+		if !ok || !result.Success {
+			failed = append(failed, fmt.Errorf("copy %s: %s", src.GetID(), batchFailure(src.GetID(), result, ok)))
+			continue
+		}
+		obj := copiedObject(src, d.localID(result.NewID.String(), src.IsDir()), dstDir)
+		d.cacheItem(obj)
+		copied = append(copied, obj)
+	}
+	return copied, errors.Join(failed...)
+}
+
+// MergeFolders 将 srcDir 的所有子项移动到 dstDir，与 dstDir 中条目同名时按 OverwritePolicy 处理：
+// skip 保留在 srcDir 中，rename 重命名后移动，overwrite 删除 dstDir 中的同名条目后移动；
+// 两边同名的文件夹递归合并。开启 RemoveMergedFolder 时删除合并后已为空的 srcDir
+// 中途失败或 ctx 取消时返回的错误中包含已移动的条目数
+func (d *CZK) MergeFolders(ctx context.Context, srcDir, dstDir model.Obj) error {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if !srcDir.IsDir() || !dstDir.IsDir() {
+		return errs.NotFolder
+	}
+	moved, _, err := d.mergeFolders(ctx, srcDir, dstDir)
+	if err != nil {
+		return fmt.Errorf("merge of folder %s stopped after moving %d items: %w", srcDir.GetID(), moved, err)
+	}
+	return nil
+}
+
+// mergeFolders 执行 MergeFolders 的合并，返回已移动的条目数以及 srcDir 是否已被删除
+func (d *CZK) mergeFolders(ctx context.Context, srcDir, dstDir model.Obj) (moved int, removed bool, err error) {
+	srcChildren, err := d.List(ctx, srcDir, model.ListArgs{})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list source folder: %w", err)
+	}
+	dstChildren, err := d.List(ctx, dstDir, model.ListArgs{})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list destination folder: %w", err)
+	}
+	existing := make(map[string]model.Obj, len(dstChildren))
+	for _, child := range dstChildren {
+		existing[child.GetName()] = child
+	}
+	var toMove []model.Obj
+	kept := 0
+	for _, child := range srcChildren {
+		if err := ctx.Err(); err != nil {
+			return moved, false, err
+		}
+		dst, collides := existing[child.GetName()]
+		switch {
+		case !collides:
+		case child.IsDir() && dst.IsDir():
+			n, childRemoved, err := d.mergeFolders(ctx, child, dst)
+			moved += n
+			if err != nil {
+				return moved, false, err
+			}
+			// 子文件夹中有被跳过的条目时仍保留在 srcDir 中
+			if !childRemoved {
+				kept++
+			}
+			continue
+		case d.OverwritePolicy == "skip":
+			kept++
+			continue
+		case d.OverwritePolicy == "overwrite":
+			if err := d.Remove(ctx, dst); err != nil {
+				return moved, false, fmt.Errorf("failed to remove %s before overwriting: %w", dst.GetName(), err)
+			}
+		default:
+			renamed, err := d.Rename(ctx, child, freeName(child.GetName(), existing))
+			if err != nil {
+				return moved, false, fmt.Errorf("failed to rename %s before moving: %w", child.GetName(), err)
+			}
+			child = renamed
+		}
+		existing[child.GetName()] = child
+		toMove = append(toMove, child)
+	}
+	if len(toMove) > 0 {
+		n, err := d.moveAll(ctx, toMove, dstDir)
+		moved += n
+		if err != nil {
+			return moved, false, err
+		}
+	}
+	if kept > 0 || !d.RemoveMergedFolder {
+		return moved, false, nil
+	}
+	if err := d.Remove(ctx, srcDir); err != nil {
+		return moved, false, fmt.Errorf("failed to remove merged folder %s: %w", srcDir.GetName(), err)
+	}
+	return moved, true, nil
+}
+
+// moveAll 将 objs 移动到 dstDir，后端支持批量移动接口时只发送一次请求，否则逐个移动
+func (d *CZK) moveAll(ctx context.Context, objs []model.Obj, dstDir model.Obj) (moved int, err error) {
+	results, err := d.batchMove(ctx, objs, dstDir)
+	if errors.Is(err, errs.NotSupport) {
+		for _, obj := range objs {
+			if err := ctx.Err(); err != nil {
+				return moved, err
+			}
+			if _, err := d.Move(ctx, obj, dstDir); err != nil {
+				return moved, fmt.Errorf("move %s: %w", obj.GetName(), err)
+			}
+			moved++
+		}
+		return moved, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var failed []error
+	for _, obj := range objs {
+		result, ok := results[backendID(obj.GetID())]
+		if !ok || !result.Success {
+			failed = append(failed, fmt.Errorf("move %s: %s", obj.GetName(), batchFailure(obj.GetID(), result, ok)))
+			continue
+		}
+		if obj.IsDir() {
+			d.invalidateSubtree(obj.GetPath())
+		}
+		moved++
+	}
+	op.ClearCache(d, dstDir.GetPath())
+	return moved, errors.Join(failed...)
+}
+
+// batchMove 调用批量移动接口，返回以对象ID为键的执行结果，接口不可用时返回 errs.NotSupport
+func (d *CZK) batchMove(ctx context.Context, objs []model.Obj, dstDir model.Obj) (map[string]BatchItemResult, error) {
+	if d.unsupported("batch_move") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	items := make([]BatchItem, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, BatchItem{ID: backendID(obj.GetID()), Type: itemType(obj)})
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch move items: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("items", string(itemsJSON))
+	_ = writer.WriteField("target_id", backendID(dstDir.GetID()))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch move form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("batch_move"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch move request: %w", err)
+	}
+	if d.probeUnsupported("batch_move", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to batch move with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var batchResp BatchResp
+	if err := decodeJSON(resp.Body(), &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch move response: %w", err)
+	}
+	if code, message, failed := batchResp.failed(); failed {
+		return nil, fmt.Errorf("batch move API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	results := make(map[string]BatchItemResult, len(batchResp.Data.Results))
+	for _, result := range batchResp.Data.Results {
+		results[result.ID.String()] = result
+	}
+	return results, nil
+}
+
+// batchCopy 调用批量复制接口，返回以源对象ID为键的执行结果，接口不可用时返回 errs.NotSupport
+func (d *CZK) batchCopy(ctx context.Context, objs []model.Obj, dstDir model.Obj) (map[string]BatchItemResult, error) {
+	if d.unsupported("batch_copy") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	items := make([]BatchItem, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, BatchItem{ID: backendID(obj.GetID()), Type: itemType(obj)})
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch copy items: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("items", string(itemsJSON))
+	_ = writer.WriteField("target_id", backendID(dstDir.GetID()))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch copy form: %w", err)
+	}
+	resp, err := d.postForm(d.withIdempotencyKey(ctx), d.apiURL("batch_copy"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch copy request: %w", err)
+	}
+	if d.probeUnsupported("batch_copy", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to batch copy with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var batchResp BatchResp
+	if err := decodeJSON(resp.Body(), &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch copy response: %w", err)
+	}
+	if code, message, failed := batchResp.failed(); failed {
+		return nil, fmt.Errorf("batch copy API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	results := make(map[string]BatchItemResult, len(batchResp.Data.Results))
+	for _, result := range batchResp.Data.Results {
+		results[result.ID.String()] = result
+	}
+	return results, nil
+}
+
+// BatchSetModTime 批量设置对象的修改时间，times 的键为对象ID，用于迁移后保留原始时间。
+// 后端支持批量接口时只发送一次请求，否则逐个设置；返回的映射只包含设置失败的对象，
+// 整个请求失败时返回 error
+func (d *CZK) BatchSetModTime(ctx context.Context, times map[string]time.Time) (map[string]error, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	failed := make(map[string]error)
+	if len(times) == 0 {
+		return failed, nil
+	}
+	results, err := d.batchSetModTime(ctx, times)
+	if errors.Is(err, errs.NotSupport) {
+		for id, modified := range times {
+			if err := ctx.Err(); err != nil {
+				return failed, err
+			}
+			if err := d.setModTime(ctx, d.itemByID(id), modified); err != nil {
+				failed[id] = err
+			}
+		}
+		return failed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for id := range times {
+		if result, ok := results[backendID(id)]; !ok || !result.Success {
+			failed[id] = fmt.Errorf("set modified time API error: %s", batchFailure(id, result, ok))
+		}
+	}
+	return failed, nil
+}
+
+// batchSetModTime 调用批量设置修改时间接口，返回以后端ID为键的执行结果，接口不可用时返回 errs.NotSupport
+func (d *CZK) batchSetModTime(ctx context.Context, times map[string]time.Time) (map[string]BatchItemResult, error) {
+	if d.unsupported("batch_set_mod_time") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	items := make([]BatchItem, 0, len(times))
+	for id, modified := range times {
+		items = append(items, BatchItem{
+			ID:       backendID(id),
+			Type:     itemType(d.itemByID(id)),
+			Modified: modified.UTC().Format("2006-01-02 15:04:05"),
+		})
+	}
+	// 按ID排序，使请求内容稳定
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch set modified time items: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("items", string(itemsJSON))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch set modified time form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("batch_set_mod_time"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch set modified time request: %w", err)
+	}
+	if d.probeUnsupported("batch_set_mod_time", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to batch set modified time with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var batchResp BatchResp
+	if err := decodeJSON(resp.Body(), &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch set modified time response: %w", err)
+	}
+	if code, message, failed := batchResp.failed(); failed {
+		return nil, fmt.Errorf("batch set modified time API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	results := make(map[string]BatchItemResult, len(batchResp.Data.Results))
+	for _, result := range batchResp.Data.Results {
+		results[result.ID.String()] = result
+	}
+	return results, nil
+}
+
+// setModTime 调用单个设置修改时间接口
+func (d *CZK) setModTime(ctx context.Context, obj model.Obj, modified time.Time) error {
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(obj.GetID()))
+	_ = writer.WriteField("type", itemType(obj))
+	_ = writer.WriteField("modified", modified.UTC().Format("2006-01-02 15:04:05"))
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to create set modified time form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("set_mod_time"), writer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to send set modified time request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to set modified time with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return fmt.Errorf("failed to parse set modified time response: %w", err)
+	}
+	if code, message, failed := envelopeError(operationResp); failed {
+		return fmt.Errorf("set modified time API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	return nil
+}
+
+// copyItem 调用单个复制接口将对象复制到 dstDir，文件夹由后端递归复制
+func (d *CZK) copyItem(ctx context.Context, srcObj, dstDir model.Obj) (*Object, error) {
+	if d.unsupported("copy_item") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(srcObj.GetID()))
+	_ = writer.WriteField("type", itemType(srcObj))
+	_ = writer.WriteField("target_id", backendID(dstDir.GetID()))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create copy form: %w", err)
+	}
+	resp, err := d.postForm(d.withIdempotencyKey(ctx), d.apiURL("copy_item"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send copy request: %w", err)
+	}
+	if d.probeUnsupported("copy_item", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to copy item with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var operationResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &operationResp); err != nil {
+		return nil, fmt.Errorf("failed to parse copy response: %w", err)
+	}
+	if code, message, failed := envelopeError(operationResp); failed {
+		return nil, fmt.Errorf("copy item API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	newID := ""
+	if data, ok := operationResp["data"].(map[string]interface{}); ok {
+		if id, ok := data["new_id"].(float64); ok {
+			newID = fmt.Sprintf("%.0f", id)
+		} else {
+			newID = getStringValue(data["new_id"])
+		}
+	}
+	if newID == "" {
+		return nil, fmt.Errorf("copy succeeded but no new_id found in response")
+	}
+	obj := copiedObject(srcObj, d.localID(newID, srcObj.IsDir()), dstDir)
+	d.cacheItem(obj)
+	return obj, nil
+}
+
+// copiedObject 根据源对象构建复制得到的新对象
+func copiedObject(src model.Obj, newID string, dstDir model.Obj) *Object {
+	return &Object{
+		Object: model.Object{
+			ID:       newID,
+			Name:     src.GetName(),
+			Size:     src.GetSize(),
+			Modified: time.Now(),
+			IsFolder: src.IsDir(),
+		},
+		ParentID: dstDir.GetID(),
+	}
+}
+
+// ListRecent 获取最近上传或修改的文件，最多返回 limit 个，对象携带后端返回的路径
+// 后端不支持最近文件接口时返回 errs.NotSupport
+func (d *CZK) ListRecent(ctx context.Context, limit int) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.unsupported("recent_files") {
+		return nil, errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	req := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer())
+	if limit > 0 {
+		req.SetQueryParam("limit", strconv.Itoa(limit))
+	}
+	resp, err := req.Get(d.apiURL("recent_files"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send recent files request: %w", err)
+	}
+	if d.probeUnsupported("recent_files", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to list recent files with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var recentResp RecentFilesResp
+	if err = decodeJSON(resp.Body(), &recentResp); err != nil {
+		return nil, fmt.Errorf("failed to parse recent files response: %w", err)
+	}
+	if code, message, failed := recentResp.failed(); failed {
+		return nil, fmt.Errorf("recent files API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	var objs []model.Obj
+	for _, item := range recentResp.Data.Items {
+		if limit > 0 && len(objs) >= limit {
+			break
+		}
+		obj := d.parseListItem(item)
+		if obj == nil {
+			continue
+		}
+		obj.ParentID = d.localID(item.ParentID.String(), true)
+		obj.Path = item.Path
+		d.cacheItem(obj)
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// SetNote 设置文件或文件夹的备注，note 为空时清除备注
+// 后端不支持备注接口时返回 errs.NotSupport
+func (d *CZK) SetNote(ctx context.Context, obj model.Obj, note string) error {
+	if n := utf8.RuneCountInString(note); n > maxNoteLength {
+		return fmt.Errorf("note is too long: %d characters, at most %d allowed", n, maxNoteLength)
+	}
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if d.unsupported("set_note") {
+		return errs.NotSupport
+	}
+	if err = d.refreshTokenIfNeeded(ctx); err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("id", backendID(obj.GetID()))
+	_ = writer.WriteField("type", itemType(obj))
+	_ = writer.WriteField("note", note)
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to create set note form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("set_note"), writer, payload)
+	if err != nil {
+		return fmt.Errorf("failed to send set note request: %w", err)
+	}
+	if d.probeUnsupported("set_note", resp) {
+		return errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to set note with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var operationResp map[string]interface{}
+	if err = decodeJSON(resp.Body(), &operationResp); err != nil {
+		return fmt.Errorf("failed to parse set note response: %w", err)
+	}
+	if code, message, failed := envelopeError(operationResp); failed {
+		return fmt.Errorf("set note API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	if cached, ok := d.cachedItem(obj.GetID()); ok {
+		updated := *cached
+		updated.Note = note
+		d.cacheItem(&updated)
+	}
+	return nil
+}
+
+// BatchRename 批量重命名，renames 为对象ID到新名称的映射，返回以ID为键的重命名后对象
+// 后端支持批量重命名接口时只发送一次请求，否则逐个调用 Rename
+func (d *CZK) BatchRename(ctx context.Context, renames map[string]string) (map[string]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	renamed := make(map[string]model.Obj, len(renames))
+	var failed []error
+	results, err := d.batchRename(ctx, renames)
+	if errors.Is(err, errs.NotSupport) {
+		for id, newName := range renames {
+			obj, err := d.Rename(ctx, d.itemByID(id), newName)
+			if err != nil {
+				failed = append(failed, fmt.Errorf("rename %s: %w", id, err))
+				continue
+			}
+			renamed[id] = obj
+		}
+		return renamed, errors.Join(failed...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for id, newName := range renames {
+		result, ok := results[backendID(id)]
+		if !ok || !result.Success {
+			failed = append(failed, fmt.Errorf("rename %s: %s", id, batchFailure(id, result, ok)))
+			continue
+		}
+		src := d.itemByID(id)
+		renamed[id] = &Object{
+			Object: model.Object{
+				ID:       id,
+				Name:     newName,
+				Size:     src.GetSize(),
+				Modified: time.Now(),
+				IsFolder: src.IsDir(),
+			},
+		}
+	}
+	return renamed, errors.Join(failed...)
+}
+
+// batchRename 调用批量重命名接口，返回以对象ID为键的结果
+func (d *CZK) batchRename(ctx context.Context, renames map[string]string) (map[string]BatchItemResult, error) {
+	if d.unsupported("batch_rename") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	items := make([]BatchItem, 0, len(renames))
+	for id, newName := range renames {
+		items = append(items, BatchItem{ID: backendID(id), Type: itemType(d.itemByID(id)), NewName: newName})
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch rename items: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("items", string(itemsJSON))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch rename form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("batch_rename"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch rename request: %w", err)
+	}
+	if d.probeUnsupported("batch_rename", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to batch rename with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var batchResp BatchResp
+	if err := decodeJSON(resp.Body(), &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch rename response: %w", err)
+	}
+	if code, message, failed := batchResp.failed(); failed {
+		return nil, fmt.Errorf("batch rename API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	results := make(map[string]BatchItemResult, len(batchResp.Data.Results))
+	for _, result := range batchResp.Data.Results {
+		results[result.ID.String()] = result
+	}
+	return results, nil
+}
+
+// BatchRemove 批量删除对象，返回以对象ID为键的每项删除结果（成功为nil）
+// 后端不支持批量删除接口时逐个调用 Remove
+func (d *CZK) BatchRemove(ctx context.Context, objs []model.Obj) map[string]error {
+	results := make(map[string]error, len(objs))
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		for _, obj := range objs {
+			results[obj.GetID()] = err
+		}
+		return results
+	}
+	defer release()
+	batchResults, err := d.batchRemove(ctx, objs)
+	if errors.Is(err, errs.NotSupport) {
+		for _, obj := range objs {
+			results[obj.GetID()] = d.Remove(ctx, obj)
+		}
+		return results
+	}
+	for _, obj := range objs {
+		if err != nil {
+			results[obj.GetID()] = err
+			continue
+		}
+		result, ok := batchResults[backendID(obj.GetID())]
+		switch {
+		case !ok:
+			results[obj.GetID()] = fmt.Errorf("no delete result returned for item %s", obj.GetID())
+		case !result.Success:
+			results[obj.GetID()] = fmt.Errorf("delete item API error: id=%s, message=%s", obj.GetID(), batchFailure(obj.GetID(), result, ok))
+		default:
+			results[obj.GetID()] = nil
+		}
+	}
+	return results
+}
+
+// batchRemove 调用批量删除接口，返回以对象ID为键的结果
+func (d *CZK) batchRemove(ctx context.Context, objs []model.Obj) (map[string]BatchItemResult, error) {
+	if d.unsupported("batch_delete") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	items := make([]BatchItem, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, BatchItem{ID: backendID(obj.GetID()), Type: itemType(obj)})
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch delete items: %w", err)
+	}
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("items", string(itemsJSON))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create batch delete form: %w", err)
+	}
+	resp, err := d.postForm(ctx, d.apiURL("batch_delete"), writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch delete request: %w", err)
+	}
+	if d.probeUnsupported("batch_delete", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to batch delete with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var batchResp BatchResp
+	if err := decodeJSON(resp.Body(), &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse batch delete response: %w", err)
+	}
+	if code, message, failed := batchResp.failed(); failed {
+		return nil, fmt.Errorf("batch delete API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	results := make(map[string]BatchItemResult, len(batchResp.Data.Results))
+	for _, result := range batchResp.Data.Results {
+		results[result.ID.String()] = result
+	}
+	return results, nil
+}
+
+// 修复后的Put方法（核心更新：补充文件上传步骤、提取file_id）
+func (d *CZK) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	return d.PutAs(ctx, dstDir, file.GetName(), file, up)
+}
+
+// PutToPath 将文件上传到以路径指定的文件夹，路径相对于根目录
+// 开启 CreateParentFolders 时自动创建缺失的中间文件夹，否则缺失时返回 errs.ObjectNotFound
+func (d *CZK) PutToPath(ctx context.Context, dstPath string, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	dstDir, err := d.resolveDir(ctx, dstPath, d.CreateParentFolders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dstPath, err)
+	}
+	return d.PutAs(ctx, dstDir, file.GetName(), file, up)
+}
+
+// resolveDir 从根目录逐级查找路径对应的文件夹，create 为 true 时创建缺失的文件夹（相当于 mkdir -p）
+func (d *CZK) resolveDir(ctx context.Context, dirPath string, create bool) (model.Obj, error) {
+	var dir model.Obj = &Object{Object: model.Object{ID: d.RootFolderID, Path: "/", IsFolder: true}}
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+dirPath), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		objs, err := d.listAll(ctx, dir, nil)
+		if err != nil {
+			return nil, err
+		}
+		var next model.Obj
+		for _, obj := range objs {
+			if obj.GetName() == name {
+				next = obj
+				break
+			}
+		}
+		switch {
+		case next != nil && !next.IsDir():
+			return nil, fmt.Errorf("%s: %w", path.Join(dir.GetPath(), name), errs.NotFolder)
+		case next == nil && !create:
+			return nil, fmt.Errorf("%s: %w", path.Join(dir.GetPath(), name), errs.ObjectNotFound)
+		case next == nil:
+			created, err := d.MakeDir(ctx, dir, name)
+			if err != nil {
+				return nil, err
+			}
+			obj := &Object{
+				Object:   model.Object{ID: created.GetID(), Name: name, Modified: created.ModTime(), IsFolder: true},
+				ParentID: dir.GetID(),
+			}
+			obj.Path = path.Join(dir.GetPath(), name)
+			d.cacheItem(obj)
+			next = obj
+		}
+		dir = next
+	}
+	return dir, nil
+}
+
+// PutAs 以指定的文件名上传文件流，而不是使用文件流自身的名称
+func (d *CZK) PutAs(ctx context.Context, dstDir model.Obj, name string, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	ctx, releaseUpload, err := d.acquireUpload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseUpload()
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !dstDir.IsDir() {
+		return nil, errs.NotFolder
+	}
+	name = d.normalizeName(name)
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	// 目标文件夹设置了容量上限时，在上传前检查剩余容量
+	if err := d.checkFolderQuota(dstDir, file.GetSize()); err != nil {
+		return nil, err
+	}
+
+	// 1. 计算文件MD5并缓存文件流
+	tempFile, md5Hash, err := d.cacheAndHash(file, &up)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate file md5: %w", err)
+	}
+	// 空文件没有内容需要上传，使用空内容的MD5完成预备和完成上传两个步骤
+	isEmpty := file.GetSize() == 0
+	if isEmpty {
+		md5Hash = emptyMD5
+	}
+
+	// 2. 调用预备上传接口（first_upload）
+	initURL := d.apiURL("first_upload")
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("hash", md5Hash)
+	_ = writer.WriteField("filename", name)
+	_ = writer.WriteField("filesize", fmt.Sprintf("%d", file.GetSize()))
+	_ = writer.WriteField("folder", backendID(dstDir.GetID()))
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create init upload form: %w", err)
+	}
+
+	resp, err := d.postForm(ctx, initURL, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send init upload request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to initialize upload with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+
+	// 解析预备上传响应，提取关键参数
+	var initResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &initResp); err != nil {
+		return nil, fmt.Errorf("failed to parse upload init response: %w", err)
+	}
+	// 校验预备上传接口返回状态
+	if code, message, failed := envelopeError(initResp); failed {
+		return nil, fmt.Errorf("init upload API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+
+	// 提取预备上传返回的核心参数
+	data, _ := initResp["data"].(map[string]interface{})
+	// 后端已有相同内容的文件时（秒传）预备上传即完成上传，无需发送文件内容和调用完成上传接口
+	if rapid, _ := data["rapid"].(bool); rapid || data["exists"] == true {
+		log.Printf("CZK Put: %s already exists on the server, completed by hash", name)
+		if up != nil {
+			up(100)
+		}
+		return d.uploadedObject(ctx, dstDir, name, file.GetSize(), md5Hash, data)
+	}
+	csrfToken := getStringValue(data["csrf_token"])
+	fileKey := getStringValue(data["file_key"])
+	uploadURL := getStringValue(data["upload_url"])
+
+	// 校验核心参数完整性
+	if csrfToken == "" || fileKey == "" || uploadURL == "" {
+		return nil, fmt.Errorf("missing required params from init response: csrf_token=%s, file_key=%s, upload_url=%s", csrfToken, fileKey, uploadURL)
+	}
+
+	// 后端已收到同一文件此前中断的部分上传时返回 received_bytes，从该偏移继续发送剩余内容
+	var received int64
+	switch v := data["received_bytes"].(type) {
+	case float64:
+		received = int64(v)
+	case string:
+		received, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if received < 0 || received > file.GetSize() {
+		return nil, fmt.Errorf("%w: server reports %d bytes received for a %d-byte file", ErrUploadOffset, received, file.GetSize())
+	}
+
+	// 3. 向预备接口返回的 upload_url 上传文件内容（空文件和已全部收到的文件跳过）
+	// 开启分片时按 UploadChunkSize 依次发送字节范围，单个分片失败只重试该分片
+	if !isEmpty && received < file.GetSize() {
+		if received > 0 {
+			log.Printf("CZK Put: resuming upload of %s from byte %d", name, received)
+		}
+		size := file.GetSize()
+		chunkSize := size - received
+		if d.UploadChunkSize > 0 && int64(d.UploadChunkSize)<<20 < chunkSize {
+			chunkSize = int64(d.UploadChunkSize) << 20
+		}
+		progress := throttleProgress(up, time.Duration(d.ProgressInterval)*time.Millisecond)
+		// 重试的分片从头发送，进度只在超过已报告的值时更新，避免回退
+		var reported float64
+		for offset := received; offset < size; offset += chunkSize {
+			length := chunkSize
+			if size-offset < length {
+				length = size - offset
+			}
+			chunkProgress := func(p float64) {
+				if v := (float64(offset) + p/100*float64(length)) * 100 / float64(size); v > reported {
+					reported = v
+					progress(v)
+				}
+			}
+			for attempt := 0; ; attempt++ {
+				err = d.uploadChunk(ctx, uploadURL, csrfToken, tempFile, offset, length, size, chunkProgress)
+				if err == nil || ctx.Err() != nil || attempt >= chunkMaxRetries {
+					break
+				}
+				wait := chunkRetryBaseDelay << attempt
+				d.warnf("CZK Put: failed to upload bytes %d-%d of %s, retrying in %v (attempt %d/%d): %v", offset, offset+length-1, name, wait, attempt+1, chunkMaxRetries, err)
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 4. 调用完成上传接口（ok_upload）
+	completeURL := d.apiURL("ok_upload")
+	completePayload := &bytes.Buffer{}
+	completeWriter := multipart.NewWriter(completePayload)
+	_ = completeWriter.WriteField("hash", md5Hash)
+	_ = completeWriter.WriteField("filename", name)
+	_ = completeWriter.WriteField("filesize", fmt.Sprintf("%d", file.GetSize()))
+	_ = completeWriter.WriteField("csrf_token", csrfToken)
+	_ = completeWriter.WriteField("file_key", fileKey)
+	_ = completeWriter.WriteField("folder", backendID(dstDir.GetID()))
+	if err := completeWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create complete upload form: %w", err)
+	}
+
+	// 后端可能仍在处理刚上传的内容，此时使用相同的 csrf_token/file_key 和幂等键退避重试
+	completeCtx := d.withIdempotencyKey(ctx)
+	var completeRespData map[string]interface{}
+	for attempt := 0; ; attempt++ {
+		var processing bool
+		completeRespData, processing, err = d.completeUpload(completeCtx, completeURL, completeWriter, completePayload)
+		if !processing || attempt >= completeMaxRetries {
+			break
+		}
+		wait := completeRetryBaseDelay << attempt
+		d.warnf("CZK Put: upload of %s is still being processed, retrying completion in %v (attempt %d/%d)", name, wait, attempt+1, completeMaxRetries)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	completeData, _ := completeRespData["data"].(map[string]interface{})
+	return d.uploadedObject(ctx, dstDir, name, file.GetSize(), md5Hash, completeData)
+}
+
+// uploadBody 返回缓存文件中 [offset, offset+length) 的上传内容，发送时按已发送的比例调用 up 并应用上传限速。
+// 缓存的读取位置在计算MD5后不可靠（部分实现无法真正回退），
+// 缓存总是实现 io.ReaderAt，使用 SectionReader 读取，重试时也能从头读取
+func (d *CZK) uploadBody(ctx context.Context, file io.ReaderAt, offset, length int64, up driver.UpdateProgress) io.Reader {
+	// 上传进度在限速之后统计，反映实际发送的速度
+	var body io.Reader = &driver.ReaderUpdatingProgress{
+		Reader:         &driver.SimpleReaderWithSize{Reader: io.NewSectionReader(file, offset, length), Size: length},
+		UpdateProgress: up,
+	}
+	if d.uploadLimiter != nil {
+		body = &driver.RateLimitReader{
+			Reader:  &limitedChunkReader{Reader: body, size: d.uploadLimiter.Burst()},
+			Limiter: d.uploadLimiter,
+			Ctx:     ctx,
+		}
+	}
+	return body
+}
+
+// uploadChunk 向 upload_url 发送缓存文件中 [offset, offset+length) 的内容，
+// 不是完整文件时通过 Content-Range 告知后端该分片的位置
+func (d *CZK) uploadChunk(ctx context.Context, uploadURL, csrfToken string, file io.ReaderAt, offset, length, size int64, up driver.UpdateProgress) error {
+	body := d.uploadBody(ctx, file, offset, length, up)
+	req := d.uploadHTTP().R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetHeader("X-CSRF-Token", csrfToken).
+		SetBody(body)
+	if length < size {
+		req.SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+	}
+	resp, err := req.Put(uploadURL)
+	if err != nil {
+		return fmt.Errorf("failed to upload file to %s: %w", uploadURL, err)
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return fmt.Errorf("file upload failed with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	return nil
+}
+
+// uploadedObject 根据完成上传（或秒传）响应中的 data 构建上传后的文件对象
+func (d *CZK) uploadedObject(ctx context.Context, dstDir model.Obj, name string, size int64, md5Hash string, completeData map[string]interface{}) (model.Obj, error) {
+	// 提取 file_id（通常为数字，部分版本返回字符串）和服务端记录的上传时间
+	fileID := ""
+	switch fid := completeData["file_id"].(type) {
+	case float64:
+		fileID = fmt.Sprintf("%.0f", fid)
+	case string:
+		fileID = fid
+	}
+	modified := time.Now()
+	if t, err := time.Parse("2006-01-02 15:04:05", getStringValue(completeData["uploaded_at"])); err == nil {
+		modified = t
+	}
+	// 响应中没有 file_id 时在目标文件夹中按名称和哈希查找刚上传的文件，
+	// 使返回的对象可以立即用于 Link、Rename 等操作
+	var resolved model.Obj
+	if fileID == "" {
+		var err error
+		resolved, err = d.findUploaded(ctx, dstDir, name, size, md5Hash)
+		if err != nil {
+			return nil, fmt.Errorf("upload succeeded but no file_id found in response, failed to look it up: %w", err)
+		}
+		if resolved == nil {
+			return nil, fmt.Errorf("upload succeeded but no file_id found in response or in folder %s", dstDir.GetID())
+		}
+		fileID = backendID(resolved.GetID())
+	}
+	// 后端会对上传内容进行病毒扫描，开启 WaitForScan 时等待扫描完成，使返回的文件可以立即下载
+	if d.WaitForScan && fileID != "" {
+		if err := d.awaitScan(ctx, fileID, getStringValue(completeData["scan_status"])); err != nil {
+			return nil, err
+		}
+	}
+	if resolved != nil {
+		return resolved, nil
+	}
+	// 开启 RelistAfterPut 时重新列出目标文件夹，返回包含服务端时间等完整信息的对象
+	if d.RelistAfterPut {
+		uploaded, err := d.findUploaded(ctx, dstDir, name, size, md5Hash)
+		if err != nil {
+			d.warnf("CZK Put: failed to re-list %s after upload: %v", dstDir.GetID(), err)
+		} else if uploaded != nil {
+			return uploaded, nil
+		}
+	}
+
+	// 5. 构建并返回包含正确ID的文件对象
+	newObj := &model.Object{
+		ID:       d.localID(fileID, false), // 赋值从响应中提取的file_id
+		Name:     name,
+		Size:     size,
+		Modified: modified,
+		IsFolder: false,
+	}
+	return newObj, nil
+}
+
+// completeUpload 调用完成上传接口，返回响应内容；processing 为 true 表示后端仍在处理上传内容，可以重试
+func (d *CZK) completeUpload(ctx context.Context, url string, writer *multipart.Writer, payload *bytes.Buffer) (data map[string]interface{}, processing bool, err error) {
+	resp, err := d.postForm(ctx, url, writer, payload)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to send complete upload request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusAccepted {
+		return nil, true, fmt.Errorf("upload is still being processed: %s%s", resp.String(), traceSuffix(resp))
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to complete upload with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	if err := decodeJSON(resp.Body(), &data); err != nil {
+		return nil, false, fmt.Errorf("failed to parse upload complete response: %w", err)
+	}
+	// 校验完成上传接口返回状态
+	if code, message, failed := envelopeError(data); failed {
+		return nil, code == uploadProcessingCode, fmt.Errorf("complete upload API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	return data, false, nil
+}
+
+// checkFolderQuota 根据已知的文件夹容量信息（来自列表或 FetchDetails）检查能否再写入 size 字节
+func (d *CZK) checkFolderQuota(dstDir model.Obj, size int64) error {
+	dir, ok := dstDir.(*Object)
+	if !ok || dir.FolderQuota == 0 {
+		if dir, ok = d.cachedItem(dstDir.GetID()); !ok {
+			return nil
+		}
+	}
+	if dir.FolderQuota > 0 && dir.FolderUsed+size > dir.FolderQuota {
+		return fmt.Errorf("%w: folder %s has %d of %d bytes free, need %d", ErrFolderQuotaExceeded, dir.GetName(), max(dir.FolderQuota-dir.FolderUsed, 0), dir.FolderQuota, size)
+	}
+	return nil
+}
+
+// awaitScan 轮询文件的扫描状态直到扫描完成，扫描拒绝时删除该文件并返回 ErrScanRejected
+func (d *CZK) awaitScan(ctx context.Context, fileID, status string) error {
+	timeout := time.Duration(d.ScanTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	scanCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for status == scanStatusScanning {
+		select {
+		case <-scanCtx.Done():
+			return fmt.Errorf("virus scan of file %s did not complete in %v: %w", fileID, timeout, scanCtx.Err())
+		case <-time.After(scanPollInterval):
+		}
+		var err error
+		if status, err = d.scanStatus(scanCtx, fileID); err != nil {
+			return err
+		}
+	}
+	if status != scanStatusRejected {
+		return nil
+	}
+	if _, err := d.deleteItem(ctx, &model.Object{ID: fileID}); err != nil {
+		d.warnf("CZK Put: failed to delete scan-rejected file %s: %v", fileID, err)
+	}
+	return fmt.Errorf("%w: file %s", ErrScanRejected, fileID)
+}
+
+// scanStatus 查询文件当前的扫描状态
+func (d *CZK) scanStatus(ctx context.Context, fileID string) (string, error) {
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParam("file_id", fileID).
+		Get(d.apiURL("scan_status"))
+	if err != nil {
+		return "", fmt.Errorf("failed to send scan status request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return "", fmt.Errorf("failed to get scan status with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var statusResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &statusResp); err != nil {
+		return "", fmt.Errorf("failed to parse scan status response: %w", err)
+	}
+	if code, message, failed := envelopeError(statusResp); failed {
+		return "", fmt.Errorf("scan status API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	data, _ := statusResp["data"].(map[string]interface{})
+	return getStringValue(data["scan_status"]), nil
+}
+
+// findUploaded 在目标文件夹中按名称、大小（以及列表提供的MD5）查找刚上传的文件，未找到时返回nil
+// 通过 name_contains 参数只列出同名的条目，后端忽略该参数时在本地过滤
+func (d *CZK) findUploaded(ctx context.Context, dstDir model.Obj, name string, size int64, md5Hash string) (model.Obj, error) {
+	objs, err := d.listAll(ctx, dstDir, map[string]string{"name_contains": name})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.IsDir() || obj.GetName() != name || obj.GetSize() != size {
+			continue
+		}
+		if h := obj.GetHash().GetHash(utils.MD5); h != "" && !strings.EqualFold(h, md5Hash) {
+			continue
+		}
+		return obj, nil
+	}
+	return nil, nil
+}
+
+// UpdateContent 覆盖已存在文件的内容
+// ifMatch 不为空时作为 If-Match 前置条件发送，若文件在读取后已被修改，返回 ErrConflict
+func (d *CZK) UpdateContent(ctx context.Context, file model.Obj, fileStream model.FileStreamer, up driver.UpdateProgress, ifMatch string) (model.Obj, error) {
+	ctx, releaseUpload, err := d.acquireUpload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseUpload()
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	tempFile, md5Hash, err := d.cacheAndHash(fileStream, &up)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate file md5: %w", err)
+	}
+	url := d.apiURL("update_file")
+	req := d.uploadHTTP().R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParams(map[string]string{
+			"file_id":  backendID(file.GetID()),
+			"hash":     md5Hash,
+			"filesize": fmt.Sprintf("%d", fileStream.GetSize()),
+		}).
+		SetBody(d.uploadBody(ctx, tempFile, 0, fileStream.GetSize(), throttleProgress(up, time.Duration(d.ProgressInterval)*time.Millisecond)))
+	if ifMatch != "" {
+		req.SetHeader("If-Match", ifMatch)
+	}
+	resp, err := req.Put(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send update request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return nil, fmt.Errorf("%w: file %s no longer matches version %s", ErrConflict, file.GetID(), ifMatch)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to update file with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var updateResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &updateResp); err != nil {
+		return nil, fmt.Errorf("failed to parse update response: %w", err)
+	}
+	if code, message, failed := envelopeError(updateResp); failed {
+		if code == http.StatusPreconditionFailed {
+			return nil, fmt.Errorf("%w: %s", ErrConflict, message)
+		}
+		return nil, fmt.Errorf("update file API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	data, _ := updateResp["data"].(map[string]interface{})
+	return &Object{
+		Object: model.Object{
+			ID:       file.GetID(),
+			Name:     file.GetName(),
+			Size:     fileStream.GetSize(),
+			Modified: time.Now(),
+		},
+		ETag: getStringValue(data["etag"]),
+	}, nil
+}
+
+// ProbeEndpoint 在不携带凭证的情况下检查API主机是否可达（DNS、TLS、网络）
+// 只要服务器返回了非5xx的HTTP响应即认为可达，用于区分"无法连接服务器"和"凭证错误"
+func (d *CZK) ProbeEndpoint(ctx context.Context) error {
+	client := d.client
+	if client == nil {
+		client = resty.New().SetTransport(d.newTransport())
+	}
+	resp, err := client.R().
+		SetContext(ctx).
+		SetHeader("User-Agent", "openlist").
+		Get(d.apiBase() + "/")
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", d.apiBase(), err)
+	}
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return fmt.Errorf("endpoint %s is reachable but unhealthy, status %d", d.apiBase(), resp.StatusCode())
+	}
+	return nil
+}
+
+// TokenStatus 通过一次轻量的认证请求检查当前访问令牌是否有效，并返回距离过期的时间
+// 令牌无效时尝试刷新（刷新失败则重新认证），err 描述无法恢复的原因
+func (d *CZK) TokenStatus(ctx context.Context) (valid bool, expiresIn time.Duration, err error) {
+	d.tokenMu.Lock()
+	token, expiresAt := d.AccessToken, d.ExpiresAt
+	d.tokenMu.Unlock()
+	valid = time.Now().Before(expiresAt)
+	if valid {
+		if valid, err = d.tokenAccepted(ctx, token); err != nil {
+			return false, 0, err
+		}
+	}
+	if !valid {
+		log.Printf("CZK TokenStatus: access token is invalid, attempting to refresh")
+		if err = d.renewToken(ctx, "CZK TokenStatus", token); err != nil {
+			return false, 0, fmt.Errorf("access token is invalid and could not be renewed: %w", err)
+		}
+		d.tokenMu.Lock()
+		expiresAt = d.ExpiresAt
+		d.tokenMu.Unlock()
+	}
+	return true, time.Until(expiresAt), nil
+}
+
+// tokenAccepted 使用给定的访问令牌请求一条根目录列表，判断后端是否接受该令牌
+func (d *CZK) tokenAccepted(ctx context.Context, token string) (bool, error) {
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", "Bearer "+token).
+		SetQueryParams(map[string]string{"folder_id": d.RootFolderID, "page": "1", "page_size": "1"}).
+		Get(d.apiURL("list_files"))
+	if err != nil {
+		return false, fmt.Errorf("failed to send token check request: %w", err)
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check token with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var checkResp map[string]interface{}
+	if err := decodeJSON(resp.Body(), &checkResp); err != nil {
+		return false, fmt.Errorf("failed to parse token check response: %w", err)
+	}
+	if code, ok := checkResp["code"].(float64); ok && (int64(code) == http.StatusUnauthorized || int64(code) == http.StatusForbidden) {
+		return false, nil
+	}
+	return !tokenExpiredBody(resp.Body()), nil
+}
+
+// GetParent 获取对象的直接父文件夹，根目录没有父文件夹时返回 errs.ObjectNotFound
+func (d *CZK) GetParent(ctx context.Context, obj model.Obj) (model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if obj.GetID() == d.RootFolderID {
+		return nil, errs.ObjectNotFound
+	}
+	item, ok := d.cachedItem(obj.GetID())
+	if !ok {
+		item, err = d.getItemInfo(ctx, obj.GetID(), obj.IsDir())
+		if err != nil {
+			return nil, err
+		}
+		d.cacheItem(item)
+	}
+	parentID := item.ParentID
+	if parentID == "" {
+		return nil, errs.ObjectNotFound
+	}
+	if parentID == d.RootFolderID {
+		return &Object{Object: model.Object{ID: parentID, IsFolder: true, Modified: time.Now()}}, nil
+	}
+	return d.getItemInfo(ctx, parentID, true)
+}
+
+// FetchDetails 从后端获取对象的最新详细信息，包括父文件夹ID和文件夹容量上限
+func (d *CZK) FetchDetails(ctx context.Context, obj model.Obj) (*Object, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	info, err := d.getItemInfo(ctx, obj.GetID(), obj.IsDir())
+	if err != nil {
+		return nil, err
+	}
+	info.Path = obj.GetPath()
+	d.cacheItem(info)
+	return info, nil
+}
+
+// getItemInfo 查询单个文件或文件夹的详细信息
+func (d *CZK) getItemInfo(ctx context.Context, id string, isFolder bool) (*Object, error) {
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	itemType := "file"
+	if isFolder {
+		itemType = "folder"
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParams(map[string]string{"id": backendID(id), "type": itemType}).
+		Get(d.apiURL("get_item_info"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send item info request: %w", err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, errs.ObjectNotFound
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get item info with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var infoResp ItemInfoResp
+	if err := decodeJSON(resp.Body(), &infoResp); err != nil {
+		return nil, fmt.Errorf("failed to parse item info response: %w", err)
+	}
+	if code, message, failed := infoResp.failed(); failed {
+		return nil, fmt.Errorf("get item info API error: code=%d, message=%s%s", code, message, traceSuffix(resp))
+	}
+	if infoResp.Data == nil {
+		return nil, errs.ObjectNotFound
+	}
+	obj := d.parseListItem(*infoResp.Data)
+	if obj == nil {
+		return nil, errs.ObjectNotFound
+	}
+	obj.ParentID = d.localID(infoResp.Data.ParentID.String(), true)
+	return obj, nil
+}
+
+func (d *CZK) GetArchiveMeta(ctx context.Context, obj model.Obj, args model.ArchiveArgs) (model.ArchiveMeta, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	peek, err := d.peekArchive(ctx, obj, args.Password)
+	if errors.Is(err, errs.NotSupport) {
+		// 后端无法预览的格式交给OpenList内置的解压工具处理
+		return nil, errArchiveUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model.ArchiveMetaInfo{
+		Comment:   peek.Data.Comment,
+		Encrypted: peek.Data.Encrypted,
+		Tree:      toArchiveTree(peek.Data.Entries, "/"),
+	}, nil
+}
+
+func (d *CZK) ListArchive(ctx context.Context, obj model.Obj, args model.ArchiveInnerArgs) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	peek, err := d.peekArchive(ctx, obj, args.Password)
+	if err != nil {
+		return nil, err
+	}
+	tree := toArchiveTree(peek.Data.Entries, "/")
+	for _, name := range strings.Split(strings.Trim(args.InnerPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		var next []model.ObjTree
+		for _, node := range tree {
+			if node.IsDir() && node.GetName() == name {
+				next = node.GetChildren()
+				break
+			}
+		}
+		if next == nil {
+			return nil, errs.ObjectNotFound
+		}
+		tree = next
+	}
+	objs := make([]model.Obj, 0, len(tree))
+	for _, node := range tree {
+		objs = append(objs, node)
+	}
+	return objs, nil
+}
+
+// peekArchive 在不解压的情况下获取压缩包内的文件树
+// 后端无法预览该格式时返回 errs.NotSupport
+func (d *CZK) peekArchive(ctx context.Context, obj model.Obj, password string) (*ArchivePeekResp, error) {
+	if d.unsupported("list_archive") {
+		return nil, errs.NotSupport
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	req := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParam("file_id", backendID(obj.GetID()))
+	if password != "" {
+		req.SetQueryParam("password", password)
+	}
+	resp, err := req.Get(d.apiURL("list_archive"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send list archive request: %w", err)
+	}
+	if d.probeUnsupported("list_archive", resp) {
+		return nil, errs.NotSupport
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to list archive with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var peek ArchivePeekResp
+	if err := decodeJSON(resp.Body(), &peek); err != nil {
+		return nil, fmt.Errorf("failed to parse list archive response: %w", err)
+	}
+	switch peek.Code {
+	case 200:
+		return &peek, nil
+	case archivePasswordCode:
+		return nil, errs.WrongArchivePassword
+	case archiveUnsupportedCode:
+		return nil, errs.NotSupport
+	default:
+		return nil, fmt.Errorf("list archive API error: code=%d, message=%s%s", peek.Code, peek.Msg, traceSuffix(resp))
+	}
+}
+
+func (d *CZK) Extract(ctx context.Context, obj model.Obj, args model.ArchiveInnerArgs) (*model.Link, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.unsupported("extract_file") {
+		return nil, errArchiveUnsupported
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	req := d.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", d.bearer()).
+		SetQueryParams(map[string]string{
+			"file_id":    backendID(obj.GetID()),
+			"inner_path": args.InnerPath,
+		})
+	if args.Password != "" {
+		req.SetQueryParam("password", args.Password)
+	}
+	resp, err := req.Get(d.apiURL("extract_file"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send extract request: %w", err)
+	}
+	if d.probeUnsupported("extract_file", resp) {
+		return nil, errArchiveUnsupported
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to extract file with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var extractResp ExtractResp
+	if err := decodeJSON(resp.Body(), &extractResp); err != nil {
+		return nil, fmt.Errorf("failed to parse extract response: %w", err)
+	}
+	switch extractResp.Code {
+	case 200:
+	case archivePasswordCode:
+		return nil, errs.WrongArchivePassword
+	case archiveUnsupportedCode:
+		return nil, errArchiveUnsupported
+	default:
+		return nil, fmt.Errorf("extract file API error: code=%d, message=%s%s", extractResp.Code, extractResp.Msg, traceSuffix(resp))
+	}
+	if extractResp.Data.DownloadLink == "" {
+		return nil, fmt.Errorf("failed to get extracted file link from response")
+	}
+	downloadLink, err := d.absoluteURL(extractResp.Data.DownloadLink)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extracted file link: %w", err)
+	}
+	expiration := defaultLinkExpiration
+	if extractResp.Data.ExpiresIn > 0 {
+		expiration = time.Duration(extractResp.Data.ExpiresIn) * time.Second
+	}
+	return &model.Link{
+		URL:        downloadLink,
+		Header:     d.downloadHeader(downloadLink),
+		Expiration: &expiration,
+	}, nil
+}
+
+func (d *CZK) ArchiveDecompress(ctx context.Context, srcObj, dstDir model.Obj, args model.ArchiveDecompressArgs) ([]model.Obj, error) {
+	ctx, release, err := d.acquireOp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if d.unsupported("decompress") {
+		return nil, errArchiveUnsupported
+	}
+	if err := d.refreshTokenIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	url := d.apiURL("decompress")
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("file_id", backendID(srcObj.GetID()))
+	_ = writer.WriteField("target_id", backendID(dstDir.GetID()))
+	_ = writer.WriteField("inner_path", args.InnerPath)
+	if args.Password != "" {
+		_ = writer.WriteField("password", args.Password)
+	}
+	if args.PutIntoNewDir {
+		_ = writer.WriteField("new_folder", "1")
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create decompress form: %w", err)
+	}
+	resp, err := d.postForm(ctx, url, writer, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send decompress request: %w", err)
+	}
+	// 后端不支持服务端解压时交给OpenList内置的解压工具处理
+	if d.probeUnsupported("decompress", resp) {
+		return nil, errArchiveUnsupported
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to decompress with status %d: %s%s", resp.StatusCode(), resp.String(), traceSuffix(resp))
+	}
+	var decompressResp DecompressResp
+	if err := decodeJSON(resp.Body(), &decompressResp); err != nil {
+		return nil, fmt.Errorf("failed to parse decompress response: %w", err)
+	}
+	if decompressResp.Code == archivePasswordCode {
+		return nil, errs.WrongArchivePassword
+	}
+	if decompressResp.Code != 200 {
+		return nil, fmt.Errorf("decompress API error: code=%d, message=%s%s", decompressResp.Code, decompressResp.Msg, traceSuffix(resp))
+	}
+	objs := make([]model.Obj, 0, len(decompressResp.Data.Items))
+	for _, item := range decompressResp.Data.Items {
+		if obj := d.parseListItem(item); obj != nil {
+			obj.ParentID = dstDir.GetID()
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+func (d *CZK) GetDetails(ctx context.Context) (*model.StorageDetails, error) {
+	// 驱动尚未实现容量查询，与后端是否支持无关
+	return nil, errs.NotImplement
+}
+
+var _ driver.Driver = (*CZK)(nil)
+
+// getStringValue 从interface{}中安全地提取字符串值
+func getStringValue(val interface{}) string {
+	if str, ok := val.(string); ok {
+		return str
+	}
+	return ""
+}
+
+// 添加min函数以避免编译错误
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
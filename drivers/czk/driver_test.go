@@ -0,0 +1,3848 @@
+package czk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/go-resty/resty/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDriver 创建一个所有请求都被转发到本地mock服务器的驱动实例
+func newTestDriver(t *testing.T, handler http.Handler) *CZK {
+	t.Helper()
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}
+	d := &CZK{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		client:       resty.New().SetTransport(transport),
+	}
+	d.installMiddleware(d.client)
+	d.APIKey = "key"
+	d.APISecret = "secret"
+	return d
+}
+
+// newTestStream 创建一个内容为 content 的上传文件流
+func newTestStream(name string, content []byte) *stream.FileStream {
+	conf.MaxBufferLimit = 16 * 1024 * 1024
+	return &stream.FileStream{
+		Obj: &model.Object{
+			Name: name,
+			Size: int64(len(content)),
+		},
+		Reader: io.NopCloser(bytes.NewReader(content)),
+	}
+}
+
+// writeJSON 以JSON格式写入mock响应
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestRefreshRespParse(t *testing.T) {
+	bodies := map[string]string{
+		"without file_id": `{"status":200,"success":true,"message":"ok","data":{"access_token":"new-access","expires_in":3600,"token_type":"Bearer"}}`,
+		"with file_id":    `{"status":200,"success":true,"message":"ok","file_id":"123","data":{"access_token":"new-access","expires_in":3600,"token_type":"Bearer"}}`,
+	}
+	for name, body := range bodies {
+		var resp RefreshResp
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Errorf("%s: failed to parse refresh response: %+v", name, err)
+			continue
+		}
+		if resp.Data.AccessToken != "new-access" || resp.Data.ExpiresIn != 3600 || !resp.Success {
+			t.Errorf("%s: unexpected refresh response: %+v", name, resp)
+		}
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/refresh_token" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.FormValue("refresh_token"); got != "refresh-token" {
+			t.Errorf("unexpected refresh_token field: %q", got)
+		}
+		writeJSON(w, map[string]interface{}{
+			"status":  200,
+			"success": true,
+			"message": "ok",
+			"file_id": "ignored",
+			"data": map[string]interface{}{
+				"access_token": "new-access",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			},
+		})
+	}))
+	if err := d.refreshToken(); err != nil {
+		t.Fatalf("failed to refresh token: %+v", err)
+	}
+	if d.AccessToken != "new-access" {
+		t.Errorf("expect access token %q, got %q", "new-access", d.AccessToken)
+	}
+	if d.RefreshToken != "refresh-token" {
+		t.Errorf("refresh token should be kept when not rotated, got %q", d.RefreshToken)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	var mu sync.Mutex
+	var refreshes, auths int
+	current := "refresh-token"
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/refresh_token":
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			refreshes++
+			// 刷新令牌轮换后旧令牌立即失效
+			if r.FormValue("refresh_token") != current {
+				writeJSON(w, map[string]interface{}{"status": 401, "success": false, "message": "无效或过期的刷新令牌"})
+				return
+			}
+			current = fmt.Sprintf("refresh-%d", refreshes)
+			writeJSON(w, map[string]interface{}{"status": 200, "success": true, "data": map[string]interface{}{
+				"access_token": "new-access", "refresh_token": current, "expires_in": 3600,
+			}})
+		case "/czkapi/authenticate":
+			mu.Lock()
+			auths++
+			mu.Unlock()
+			http.Error(w, "unexpected", http.StatusInternalServerError)
+		case "/czkapi/list_files":
+			if got := r.Header.Get("Authorization"); got != "Bearer new-access" {
+				t.Errorf("expect the refreshed token, got %q", got)
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		}
+	}))
+	d.ExpiresAt = time.Now().Add(-time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{}); err != nil {
+				t.Errorf("failed to list: %+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 || auths != 0 {
+		t.Errorf("expect a single refresh shared by all callers, got %d refreshes and %d authentications", refreshes, auths)
+	}
+}
+
+func TestUpdateContentIfMatch(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/update_file" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-Match") != "v2" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"msg":  "成功",
+			"data": map[string]interface{}{"etag": "v3"},
+		})
+	}))
+	file := &Object{Object: model.Object{ID: "1", Name: "a.txt"}, ETag: "v1"}
+	_, err := d.UpdateContent(context.Background(), file, newTestStream("a.txt", []byte("new")), func(float64) {}, file.ETag)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expect ErrConflict for stale precondition, got %+v", err)
+	}
+	obj, err := d.UpdateContent(context.Background(), file, newTestStream("a.txt", []byte("new")), func(float64) {}, "v2")
+	if err != nil {
+		t.Fatalf("failed to update content: %+v", err)
+	}
+	if got := obj.(*Object).ETag; got != "v3" {
+		t.Errorf("expect new etag %q, got %q", "v3", got)
+	}
+}
+
+func TestUpdateContentProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 1<<20)
+	var received int
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+	}))
+	var progress []float64
+	if _, err := d.UpdateContent(context.Background(), &model.Object{ID: "1", Name: "a.bin"}, newTestStream("a.bin", content), func(p float64) { progress = append(progress, p) }, ""); err != nil {
+		t.Fatalf("failed to update content: %+v", err)
+	}
+	if received != len(content) {
+		t.Errorf("expect %d bytes sent, got %d", len(content), received)
+	}
+	sending := 0
+	for _, p := range progress {
+		if p > 50 && p < 100 {
+			sending++
+		}
+	}
+	if sending == 0 || progress[len(progress)-1] != 100 {
+		t.Errorf("expect progress while the body is sent, got %v", progress)
+	}
+}
+
+func TestListNamelessItem(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"code":    200,
+			"message": "成功",
+			"data": map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": 1, "name": "a.txt", "type": "file", "size": 1},
+					map[string]interface{}{"id": 2, "type": "file", "size": 2},
+				},
+				"total_count": 2,
+			},
+		})
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+
+	objs, err := d.List(context.Background(), dir, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "a.txt" {
+		t.Errorf("expect nameless item to be skipped, got %+v", objs)
+	}
+
+	d.NamelessItem = "placeholder"
+	objs, err = d.List(context.Background(), dir, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 2 || objs[1].GetName() != "unnamed_2" {
+		t.Errorf("expect placeholder name for nameless item, got %+v", objs)
+	}
+}
+
+func TestListStringNumbers(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":200,"data":{"items":[` +
+			`{"id":"7","name":"a.txt","type":"file","size":"1024","uploaded_at":"2025-06-29 15:37:01"},` +
+			`{"id":8,"name":"b","type":"folder","size":2048,"child_count":"3"}` +
+			`],"total_count":"2"}}`))
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expect both items to be listed, got %+v", objs)
+	}
+	if objs[0].GetID() != "7" || objs[0].GetSize() != 1024 || objs[0].ModTime().Format("2006-01-02 15:04:05") != "2025-06-29 15:37:01" {
+		t.Errorf("expect string id and size to be parsed, got %+v", objs[0])
+	}
+	if folder := objs[1].(*Object); folder.GetID() != "8" || folder.GetSize() != 2048 || folder.ChildCount != 3 || !folder.IsDir() {
+		t.Errorf("expect numeric fields to be parsed, got %+v", folder)
+	}
+}
+
+func TestClampFutureTimes(t *testing.T) {
+	future := time.Now().Add(48 * time.Hour).Format("2006-01-02 15:04:05")
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "future.txt", "type": "file", "uploaded_at": future},
+			map[string]interface{}{"id": 2, "name": "past.txt", "type": "file", "uploaded_at": "2025-07-01 10:00:00"},
+		}}})
+	}))
+	for _, clamp := range []bool{false, true} {
+		d.ClampFutureTimes = clamp
+		objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if len(objs) != 2 {
+			t.Fatalf("expect 2 items, got %d", len(objs))
+		}
+		if got := objs[0].ModTime(); clamp == got.After(time.Now()) {
+			t.Errorf("ClampFutureTimes=%v: unexpected modified time %v", clamp, got)
+		}
+		if got := objs[1].ModTime().Format("2006-01-02 15:04:05"); got != "2025-07-01 10:00:00" {
+			t.Errorf("expect past times to be kept, got %s", got)
+		}
+	}
+}
+
+func TestGetPreviewLink(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_item_info":
+			item := map[string]interface{}{"id": r.URL.Query().Get("id"), "name": "doc", "type": "file"}
+			switch r.URL.Query().Get("id") {
+			case "1":
+				item["preview_url"] = "/preview/1"
+			case "2":
+				item["password_protected"] = true
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": item})
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f/" + r.URL.Query().Get("file_id")}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ctx := context.Background()
+	link, err := d.GetPreviewLink(ctx, &model.Object{ID: "1", Name: "report.docx"})
+	if err != nil {
+		t.Fatalf("failed to get preview link: %+v", err)
+	}
+	if link.URL != "https://pan.szczk.top/preview/1" {
+		t.Errorf("expect the document preview url, got %s", link.URL)
+	}
+	if _, err := d.GetPreviewLink(ctx, &model.Object{ID: "2", Name: "secret.pdf"}); !errors.Is(err, ErrPasswordProtected) {
+		t.Errorf("expect ErrPasswordProtected, got %v", err)
+	}
+	if link, err = d.GetPreviewLink(ctx, &model.Object{ID: "3", Name: "notes.xlsx"}); err != nil || link.URL != "https://cdn.example.com/f/3" {
+		t.Errorf("expect the download link for a document without preview, got %+v, %v", link, err)
+	}
+	if link, err = d.GetPreviewLink(ctx, &Object{Object: model.Object{ID: "4", Name: "app.bin"}, PreviewURL: "https://pan.szczk.top/preview/4"}); err != nil || link.URL != "https://cdn.example.com/f/4" {
+		t.Errorf("expect the download link for a binary, got %+v, %v", link, err)
+	}
+}
+
+func TestDetectMimeViaHead(t *testing.T) {
+	var heads []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 1, "name": "README", "type": "file"},
+				map[string]interface{}{"id": 2, "name": "a.txt", "type": "file"},
+				map[string]interface{}{"id": 3, "name": "blob", "type": "file", "mime_type": "image/webp"},
+			}}})
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f/" + r.URL.Query().Get("file_id")}})
+		default:
+			heads = append(heads, r.Method+" "+r.URL.Path)
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		}
+	}))
+	d.DetectMimeViaHead = true
+	dir := &model.Object{ID: "0", IsFolder: true}
+	for i := 0; i < 2; i++ {
+		objs, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if got := objs[0].(*Object).MimeType; got != "text/markdown" {
+			t.Errorf("expect the HEAD content type for a file without extension, got %q", got)
+		}
+		if objs[1].(*Object).MimeType != "" || objs[2].(*Object).MimeType != "image/webp" {
+			t.Errorf("expect no detection for known types, got %+v", objs)
+		}
+	}
+	if len(heads) != 1 || heads[0] != "HEAD /f/1" {
+		t.Errorf("expect a single cached HEAD for the extensionless file, got %v", heads)
+	}
+}
+
+func TestDetectMimeViaHeadCapped(t *testing.T) {
+	var mu sync.Mutex
+	heads := 0
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			var items []interface{}
+			for i := 1; i <= 5; i++ {
+				items = append(items, map[string]interface{}{"id": i, "name": fmt.Sprintf("blob%d", i), "type": "file"})
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": items}})
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f/" + r.URL.Query().Get("file_id")}})
+		default:
+			mu.Lock()
+			heads++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/plain")
+		}
+	}))
+	d.DetectMimeViaHead = true
+	defer func(v int) { maxMimeProbesPerList = v }(maxMimeProbesPerList)
+	maxMimeProbesPerList = 2
+	dir := &model.Object{ID: "0", IsFolder: true}
+	for i, want := range []int{2, 4, 5} {
+		objs, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		detected := 0
+		for _, obj := range objs {
+			if obj.(*Object).MimeType == "text/plain" {
+				detected++
+			}
+		}
+		mu.Lock()
+		got := heads
+		mu.Unlock()
+		if got != want || detected != want {
+			t.Errorf("listing %d: expect %d probes and detected types, got %d probes and %d types", i, want, got, detected)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.mimeTypes = sync.Map{}
+	d.detectMimeTypes(ctx, []model.Obj{&Object{Object: model.Object{ID: "1", Name: "blob1"}}})
+	if heads != 5 {
+		t.Errorf("expect no probes after ctx is cancelled, got %d", heads)
+	}
+}
+
+// listItems 生成 [from, to] 区间内的文件条目
+func listItems(from, to int) []interface{} {
+	var items []interface{}
+	for i := from; i <= to; i++ {
+		items = append(items, map[string]interface{}{"id": i, "name": fmt.Sprintf("%d.txt", i), "type": "file"})
+	}
+	return items
+}
+
+func TestListPagination(t *testing.T) {
+	dir := &model.Object{ID: "0", IsFolder: true}
+	t.Run("cursor", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := map[string]interface{}{}
+			switch r.URL.Query().Get("cursor") {
+			case "":
+				data["items"], data["next_cursor"] = listItems(1, 2), "c1"
+			case "c1":
+				data["items"], data["next_cursor"] = listItems(3, 4), "c2"
+			case "c2":
+				data["items"], data["next_cursor"] = listItems(5, 5), ""
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": data})
+		}))
+		objs, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if len(objs) != 5 || objs[0].GetID() != "1" || objs[4].GetID() != "5" {
+			t.Errorf("expect 5 ordered items across cursor pages, got %+v", objs)
+		}
+	})
+	t.Run("page number", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := map[string]interface{}{"total_count": 3}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				data["items"] = listItems(1, 2)
+			case "2":
+				data["items"] = listItems(3, 3)
+			default:
+				t.Errorf("unexpected page request: %s", r.URL.RawQuery)
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": data})
+		}))
+		objs, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if len(objs) != 3 || objs[2].GetID() != "3" {
+			t.Errorf("expect 3 ordered items across pages, got %+v", objs)
+		}
+	})
+	t.Run("has_more", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := map[string]interface{}{}
+			switch r.URL.Query().Get("page") {
+			case "1":
+				data["items"], data["has_more"] = listItems(1, 2), true
+			case "2":
+				data["items"], data["has_more"] = listItems(3, 4), false
+			default:
+				t.Errorf("unexpected page request: %s", r.URL.RawQuery)
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": data})
+		}))
+		objs, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if len(objs) != 4 || objs[3].GetID() != "4" {
+			t.Errorf("expect 4 ordered items across has_more pages, got %+v", objs)
+		}
+	})
+	t.Run("page size", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("page_size"); got != "50" {
+				t.Errorf("expect the configured page size, got %q", got)
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": listItems(1, 1)}})
+		}))
+		d.PageSize = 50
+		if _, err := d.List(context.Background(), dir, model.ListArgs{}); err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+	})
+	t.Run("repeated page", func(t *testing.T) {
+		var requests int
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			// 忽略页码参数，总是返回第一页
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": listItems(1, 2), "total_count": 3000}})
+		}))
+		_, err := d.List(context.Background(), dir, model.ListArgs{})
+		if err == nil || !strings.Contains(err.Error(), "same page again") {
+			t.Errorf("expect a repeated page error, got %v", err)
+		}
+		if requests != 2 {
+			t.Errorf("expect to stop after the first repeated page, got %d requests", requests)
+		}
+	})
+}
+
+func TestListIncludeTrashed(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		items := listItems(1, 1)
+		if r.URL.Query().Get("include_trashed") == "1" {
+			items = append(items, map[string]interface{}{"id": 2, "name": "old.txt", "type": "file", "trashed": true})
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": items}})
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+
+	objs, err := d.List(context.Background(), dir, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 1 {
+		t.Errorf("expect trashed items to be excluded by default, got %d items", len(objs))
+	}
+
+	d.IncludeTrashed = true
+	objs, err = d.List(context.Background(), dir, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 2 || objs[1].GetName() != "[trashed] old.txt" || !objs[1].(*Object).Trashed {
+		t.Errorf("expect trashed item to be listed and marked, got %+v", objs)
+	}
+}
+
+func TestAuthenticateRateLimited(t *testing.T) {
+	authRetryBaseDelay = time.Millisecond
+	authOK := map[string]interface{}{
+		"status":  200,
+		"message": "认证成功",
+		"data": map[string]interface{}{
+			"access_token":  "new-access",
+			"refresh_token": "new-refresh",
+			"expires_in":    3600,
+		},
+	}
+	t.Run("429 then 200", func(t *testing.T) {
+		calls := 0
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			writeJSON(w, authOK)
+		}))
+		if err := d.authenticate(context.Background()); err != nil {
+			t.Fatalf("expect authenticate to succeed after 429, got %+v", err)
+		}
+		if calls != 2 || d.AccessToken != "new-access" {
+			t.Errorf("expect 2 auth calls and new token, got %d calls, token %q", calls, d.AccessToken)
+		}
+	})
+	t.Run("401", func(t *testing.T) {
+		calls := 0
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		if err := d.authenticate(context.Background()); err == nil {
+			t.Errorf("expect authenticate to fail on 401")
+		}
+		if calls != 1 {
+			t.Errorf("expect no retry on 401, got %d calls", calls)
+		}
+	})
+	t.Run("cancelled during backoff", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := d.authenticate(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expect the ctx deadline to stop the backoff, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expect authenticate to return within the ctx deadline, took %v", elapsed)
+		}
+	})
+}
+
+// uploadHandler 模拟 first_upload / 数据上传 / ok_upload 三个步骤的接口
+// 请求的表单字段和数据上传的内容记录在返回的 uploadRecord 中
+type uploadRecord struct {
+	first, complete map[string]string
+	body            []byte
+	uploaded        bool
+}
+
+func uploadHandler(t *testing.T, rec *uploadRecord) http.HandlerFunc {
+	formValues := func(r *http.Request) map[string]string {
+		_ = r.ParseMultipartForm(1 << 20)
+		values := map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			values[k] = v[0]
+		}
+		return values
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/first_upload":
+			rec.first = formValues(r)
+			writeJSON(w, map[string]interface{}{
+				"code": 200,
+				"data": map[string]interface{}{
+					"csrf_token": "csrf",
+					"file_key":   "key",
+					"upload_url": "https://upload.example.com/upload/key",
+				},
+			})
+		case "/upload/key":
+			rec.uploaded = true
+			rec.body, _ = io.ReadAll(r.Body)
+		case "/czkapi/ok_upload":
+			rec.complete = formValues(r)
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"file_id": 42}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestPutEmptyFile(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	obj, err := d.Put(context.Background(), dir, newTestStream("empty.txt", nil), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put empty file: %+v", err)
+	}
+	if obj.GetSize() != 0 || obj.GetID() != "42" {
+		t.Errorf("expect empty object with id 42, got %+v", obj)
+	}
+	if rec.first["hash"] != emptyMD5 || rec.complete["hash"] != emptyMD5 || rec.first["filesize"] != "0" {
+		t.Errorf("unexpected upload fields: first=%v complete=%v", rec.first, rec.complete)
+	}
+	if rec.uploaded {
+		t.Errorf("expect no data upload for an empty file")
+	}
+}
+
+func TestGetParent(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/get_item_info" {
+			http.NotFound(w, r)
+			return
+		}
+		items := map[string]map[string]interface{}{
+			"5":  {"id": 5, "name": "a.txt", "type": "file", "parent_id": 10},
+			"10": {"id": 10, "name": "docs", "type": "folder", "parent_id": 0},
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": items[r.URL.Query().Get("id")]})
+	}))
+	d.RootFolderID = "0"
+
+	parent, err := d.GetParent(context.Background(), &model.Object{ID: "5"})
+	if err != nil {
+		t.Fatalf("failed to get parent: %+v", err)
+	}
+	if parent.GetID() != "10" || parent.GetName() != "docs" || !parent.IsDir() {
+		t.Errorf("unexpected parent: %+v", parent)
+	}
+	if item, ok := d.cachedItem("5"); !ok || item.ParentID != "10" {
+		t.Errorf("expect parent id to be cached, got %+v", item)
+	}
+	if _, err := d.GetParent(context.Background(), &model.Object{ID: "0", IsFolder: true}); !errors.Is(err, errs.ObjectNotFound) {
+		t.Errorf("expect ObjectNotFound for root parent, got %+v", err)
+	}
+}
+
+func TestArchiveDecompress(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/decompress" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("password") != "pass" {
+			writeJSON(w, map[string]interface{}{"code": archivePasswordCode, "msg": "密码错误"})
+			return
+		}
+		if r.FormValue("file_id") != "7" || r.FormValue("target_id") != "10" {
+			t.Errorf("unexpected decompress form: %v", r.MultipartForm.Value)
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"msg":  "成功",
+			"data": map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": 20, "name": "photos", "type": "folder"},
+					map[string]interface{}{"id": 21, "name": "readme.txt", "type": "file", "size": 12},
+				},
+			},
+		})
+	}))
+	src := &model.Object{ID: "7", Name: "a.zip"}
+	dst := &model.Object{ID: "10", IsFolder: true}
+
+	_, err := d.ArchiveDecompress(context.Background(), src, dst, model.ArchiveDecompressArgs{})
+	if !errors.Is(err, errs.WrongArchivePassword) {
+		t.Errorf("expect WrongArchivePassword without password, got %+v", err)
+	}
+	args := model.ArchiveDecompressArgs{}
+	args.Password = "pass"
+	objs, err := d.ArchiveDecompress(context.Background(), src, dst, args)
+	if err != nil {
+		t.Fatalf("failed to decompress: %+v", err)
+	}
+	if len(objs) != 2 || !objs[0].IsDir() || objs[1].GetName() != "readme.txt" || objs[1].GetSize() != 12 {
+		t.Errorf("unexpected decompressed objects: %+v", objs)
+	}
+}
+
+func TestArchiveMeta(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("file_id") == "8" {
+			writeJSON(w, map[string]interface{}{"code": archiveUnsupportedCode, "msg": "不支持的格式"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{
+				"comment": "hello",
+				"entries": []interface{}{
+					map[string]interface{}{"name": "docs", "type": "folder", "children": []interface{}{
+						map[string]interface{}{"name": "a.txt", "type": "file", "size": 3, "modified": "2025-06-29 15:37:01"},
+					}},
+					map[string]interface{}{"name": "b.txt", "type": "file", "size": 4},
+				},
+			},
+		})
+	}))
+	meta, err := d.GetArchiveMeta(context.Background(), &model.Object{ID: "7"}, model.ArchiveArgs{})
+	if err != nil {
+		t.Fatalf("failed to get archive meta: %+v", err)
+	}
+	tree := meta.GetTree()
+	if meta.GetComment() != "hello" || len(tree) != 2 || !tree[0].IsDir() {
+		t.Fatalf("unexpected archive tree: %+v", tree)
+	}
+	if child := tree[0].GetChildren()[0]; child.GetPath() != "/docs/a.txt" || child.GetSize() != 3 {
+		t.Errorf("unexpected nested entry: %+v", child)
+	}
+
+	objs, err := d.ListArchive(context.Background(), &model.Object{ID: "7"}, model.ArchiveInnerArgs{InnerPath: "/docs"})
+	if err != nil {
+		t.Fatalf("failed to list archive: %+v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "a.txt" {
+		t.Errorf("unexpected inner listing: %+v", objs)
+	}
+
+	if _, err := d.ListArchive(context.Background(), &model.Object{ID: "8"}, model.ArchiveInnerArgs{}); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport for unpeekable archive, got %+v", err)
+	}
+	if _, err := d.GetArchiveMeta(context.Background(), &model.Object{ID: "8"}, model.ArchiveArgs{}); !errors.Is(err, errs.NotImplement) {
+		t.Errorf("expect NotImplement fallback for unpeekable archive meta, got %+v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/czkapi/extract_file" || q.Get("file_id") != "7" || q.Get("inner_path") != "/docs/a.txt" || q.Get("password") != "pass" {
+			t.Errorf("unexpected extract request: %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{
+				"download_link": "https://dl.example.com/inner/a.txt?sign=x",
+				"expires_in":    300,
+			},
+		})
+	}))
+	args := model.ArchiveInnerArgs{InnerPath: "/docs/a.txt"}
+	args.Password = "pass"
+	link, err := d.Extract(context.Background(), &model.Object{ID: "7"}, args)
+	if err != nil {
+		t.Fatalf("failed to extract: %+v", err)
+	}
+	if link.URL != "https://dl.example.com/inner/a.txt?sign=x" {
+		t.Errorf("unexpected extract link: %s", link.URL)
+	}
+	if link.Expiration == nil || *link.Expiration != 5*time.Minute {
+		t.Errorf("expect link expiration of 5m, got %v", link.Expiration)
+	}
+}
+
+func TestExtractRelativeLink(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{"download_link": "/files/inner/7?sign=x"},
+		})
+	}))
+	link, err := d.Extract(context.Background(), &model.Object{ID: "7"}, model.ArchiveInnerArgs{InnerPath: "/a.txt"})
+	if err != nil {
+		t.Fatalf("failed to extract: %+v", err)
+	}
+	if link.URL != "https://pan.szczk.top/files/inner/7?sign=x" {
+		t.Errorf("expect an absolute extract link, got %s", link.URL)
+	}
+	if link.Header.Get("Authorization") == "" {
+		t.Errorf("expect the site token on a same-host extract link, got %v", link.Header)
+	}
+}
+
+func TestMaxConcurrentOps(t *testing.T) {
+	var running, peak int32
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"status": 200, "data": map[string]interface{}{"download_link": "https://dl.example.com/f"}})
+		default:
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		}
+	}))
+	d.MaxConcurrentOps = 2
+	d.opSem = make(chan struct{}, d.MaxConcurrentOps)
+
+	ctx := context.Background()
+	dir := &model.Object{ID: "0", IsFolder: true}
+	file := &model.Object{ID: "1"}
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			switch i % 3 {
+			case 0:
+				_, err = d.List(ctx, dir, model.ListArgs{})
+			case 1:
+				_, err = d.Link(ctx, file, model.LinkArgs{})
+			case 2:
+				err = d.Remove(ctx, file)
+			}
+			if err != nil {
+				t.Errorf("operation %d failed: %+v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("expect at most 2 concurrent operations, got %d", peak)
+	}
+}
+
+func TestDiffTree(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []interface{}
+		switch r.URL.Query().Get("folder_id") {
+		case "0":
+			items = []interface{}{
+				map[string]interface{}{"id": 1, "name": "a.txt", "type": "file", "size": 10},
+				map[string]interface{}{"id": 2, "name": "docs", "type": "folder"},
+				map[string]interface{}{"id": 3, "name": "stray.log", "type": "file", "size": 5},
+				map[string]interface{}{"id": 4, "name": "img", "type": "file", "size": 1},
+			}
+		case "2":
+			items = []interface{}{
+				map[string]interface{}{"id": 5, "name": "b.txt", "type": "file", "size": 99},
+			}
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": items}})
+	}))
+	expected := []TreeEntry{
+		{Path: "/", IsFolder: true},
+		{Path: "", IsFolder: true},
+		{Path: "docs/", IsFolder: true},
+		{Path: "a.txt", Size: 10},
+		{Path: "/docs/b.txt", Size: 20},
+		{Path: "docs/c.txt", Size: 30},
+		{Path: "img", IsFolder: true},
+	}
+	diffs, err := d.DiffTree(context.Background(), &model.Object{ID: "0", IsFolder: true}, expected)
+	if err != nil {
+		t.Fatalf("failed to diff tree: %+v", err)
+	}
+	expect := []TreeDiff{
+		{Path: "docs/b.txt", Kind: DiffSizeMismatch, ExpectedSize: 20, ActualSize: 99},
+		{Path: "docs/c.txt", Kind: DiffMissing, ExpectedSize: 30},
+		{Path: "img", Kind: DiffTypeMismatch, ActualSize: 1},
+		{Path: "stray.log", Kind: DiffExtra, ActualSize: 5},
+	}
+	if fmt.Sprint(diffs) != fmt.Sprint(expect) {
+		t.Errorf("expect diffs %+v, got %+v", expect, diffs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DiffTree(ctx, &model.Object{ID: "0", IsFolder: true}, expected); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect a cancelled context to stop the walk, got %v", err)
+	}
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	var running, peak int32
+	var mu sync.Mutex
+	gate := make(chan struct{})
+	upload := uploadHandler(t, &uploadRecord{})
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+			return
+		case "/upload/key":
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-gate
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		upload(w, r)
+	}))
+	d.MaxConcurrentOps = 4
+	d.opSem = make(chan struct{}, d.MaxConcurrentOps)
+	d.MaxConcurrentUploads = 2
+	d.uploadSem = make(chan struct{}, d.MaxConcurrentUploads)
+
+	ctx := context.Background()
+	dir := &model.Object{ID: "0", IsFolder: true}
+	files := make([]*stream.FileStream, 6)
+	for i := range files {
+		files[i] = newTestStream(fmt.Sprintf("%d.txt", i), []byte("hello"))
+	}
+	var wg sync.WaitGroup
+	for _, file := range files {
+		wg.Add(1)
+		go func(file *stream.FileStream) {
+			defer wg.Done()
+			if _, err := d.Put(ctx, dir, file, func(float64) {}); err != nil {
+				t.Errorf("failed to put %s: %+v", file.GetName(), err)
+			}
+		}(file)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&running) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// 两个上传阻塞时，其余上传等待上传许可而不占用全局许可，列表操作仍能完成
+	listCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := d.List(listCtx, dir, model.ListArgs{}); err != nil {
+		t.Errorf("expect list to run while uploads are throttled: %+v", err)
+	}
+	close(gate)
+	wg.Wait()
+	if peak != 2 {
+		t.Errorf("expect exactly 2 concurrent uploads, got %d", peak)
+	}
+}
+
+func TestLinkIgnoresUnusableRange(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("offset") {
+			t.Errorf("expect no offset hint, got %q", r.URL.Query().Get("offset"))
+		}
+		writeJSON(w, map[string]interface{}{"status": 200, "data": map[string]interface{}{"download_link": "https://dl.example.com/f"}})
+	}))
+	for _, tt := range []struct {
+		rangeHeader string
+		size        int64
+	}{
+		{"bytes=abc", 1000},
+		{"bytes=0-9,20-29", 1000},
+		{"bytes=100-", 0},
+	} {
+		file := &model.Object{ID: "1", Size: tt.size}
+		if _, err := d.Link(context.Background(), file, model.LinkArgs{Header: http.Header{"Range": []string{tt.rangeHeader}}}); err != nil {
+			t.Errorf("expect %q with size %d to be ignored, got %v", tt.rangeHeader, tt.size, err)
+		}
+	}
+}
+
+func TestLinkCancel(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := d.Link(ctx, &model.Object{ID: "1"}, model.LinkArgs{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect the ctx deadline to abort the request, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect Link to return within the ctx deadline, took %v", elapsed)
+	}
+}
+
+func TestLinkResumeOffset(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			if got := r.URL.Query().Get("offset"); got != "100" {
+				t.Errorf("expect offset hint 100, got %q", got)
+			}
+			writeJSON(w, map[string]interface{}{"status": 200, "data": map[string]interface{}{"download_link": "https://dl.example.com/f"}})
+		case "/f":
+			if got := r.Header.Get("Range"); got != "bytes=100-" {
+				t.Errorf("expect download host to receive range bytes=100-, got %q", got)
+			}
+			w.WriteHeader(http.StatusPartialContent)
+		}
+	}))
+	file := &model.Object{ID: "1", Size: 1000}
+	link, err := d.Link(context.Background(), file, model.LinkArgs{Header: http.Header{"Range": []string{"bytes=100-"}}})
+	if err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	resp, err := d.client.R().SetHeaderMultiValues(link.Header).Get(link.URL)
+	if err != nil {
+		t.Fatalf("failed to request link: %+v", err)
+	}
+	if resp.StatusCode() != http.StatusPartialContent {
+		t.Errorf("expect partial content, got %d", resp.StatusCode())
+	}
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("expect probe to be sent without credentials")
+		}
+		http.NotFound(w, r)
+	}))
+	if err := d.ProbeEndpoint(context.Background()); err != nil {
+		t.Errorf("expect reachable endpoint, got %+v", err)
+	}
+
+	unreachable := &CZK{client: resty.New().SetTransport(&http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	})}
+	if err := unreachable.ProbeEndpoint(context.Background()); err == nil {
+		t.Errorf("expect unreachable endpoint to fail")
+	}
+}
+
+func TestReauthAfterRefreshes(t *testing.T) {
+	var paths []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		data := map[string]interface{}{"access_token": "access", "refresh_token": "refresh", "expires_in": 3600}
+		writeJSON(w, map[string]interface{}{"status": 200, "success": true, "message": "认证成功", "data": data})
+	}))
+	d.ReauthAfterRefreshes = 2
+	for i := 0; i < 3; i++ {
+		d.ExpiresAt = time.Now().Add(-time.Second)
+		if err := d.refreshTokenIfNeeded(context.Background()); err != nil {
+			t.Fatalf("failed to refresh token: %+v", err)
+		}
+	}
+	expect := []string{"/czkapi/refresh_token", "/czkapi/refresh_token", "/czkapi/authenticate"}
+	if fmt.Sprint(paths) != fmt.Sprint(expect) {
+		t.Errorf("expect %v, got %v", expect, paths)
+	}
+	if d.refreshCount != 0 {
+		t.Errorf("expect refresh counter to reset after re-authentication, got %d", d.refreshCount)
+	}
+}
+
+func TestPutAs(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	obj, err := d.PutAs(context.Background(), dir, "renamed.txt", newTestStream("tmp-123", []byte("hello")), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if rec.first["filename"] != "renamed.txt" || rec.complete["filename"] != "renamed.txt" {
+		t.Errorf("expect overridden name in both upload steps, got first=%q complete=%q", rec.first["filename"], rec.complete["filename"])
+	}
+	if obj.GetName() != "renamed.txt" || string(rec.body) != "hello" {
+		t.Errorf("unexpected uploaded object %+v with body %q", obj, rec.body)
+	}
+}
+
+func TestBatchRemove(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/batch_delete" {
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			return
+		}
+		var items []BatchItem
+		_ = json.Unmarshal([]byte(r.FormValue("items")), &items)
+		var results []interface{}
+		for _, item := range items {
+			switch item.ID {
+			case "2":
+				results = append(results, map[string]interface{}{"id": item.ID, "success": false, "msg": "文件被锁定"})
+			case "4":
+				results = append(results, map[string]interface{}{"id": item.ID, "success": false})
+			default:
+				results = append(results, map[string]interface{}{"id": item.ID, "success": true})
+			}
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": results}})
+	}))
+	objs := []model.Obj{&model.Object{ID: "1"}, &model.Object{ID: "2"}, &model.Object{ID: "3", IsFolder: true}, &model.Object{ID: "4"}}
+	results := d.BatchRemove(context.Background(), objs)
+	if len(results) != 4 || results["1"] != nil || results["3"] != nil {
+		t.Errorf("expect items 1 and 3 to succeed, got %v", results)
+	}
+	if results["2"] == nil || !strings.Contains(results["2"].Error(), "文件被锁定") {
+		t.Errorf("expect item 2 to fail with the backend message, got %v", results["2"])
+	}
+	if results["4"] == nil || !strings.HasSuffix(results["4"].Error(), "message=item 4 failed") {
+		t.Errorf("expect a generic reason for item 4, got %v", results["4"])
+	}
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	var encodings []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatalf("expect gzip body: %+v", err)
+			}
+			r.Body = io.NopCloser(zr)
+		}
+		if got := r.FormValue("data"); len(got) == 0 {
+			t.Errorf("expect form to be decodable")
+		}
+		writeJSON(w, map[string]interface{}{"code": 200})
+	}))
+	d.GzipRequestBody = true
+	post := func(size int) {
+		payload := &bytes.Buffer{}
+		writer := multipart.NewWriter(payload)
+		_ = writer.WriteField("data", strings.Repeat("a", size))
+		_ = writer.Close()
+		if _, err := d.postForm(context.Background(), "https://pan.szczk.top/czkapi/ok_upload", writer, payload); err != nil {
+			t.Fatalf("failed to post form: %+v", err)
+		}
+	}
+	post(10)
+	post(gzipMinSize)
+	if fmt.Sprint(encodings) != "[ gzip]" {
+		t.Errorf("expect only the large body to be gzip-encoded, got %q", encodings)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tree := map[string][]interface{}{
+		"0": {
+			map[string]interface{}{"id": 1, "name": "a.mp4", "type": "file"},
+			map[string]interface{}{"id": 2, "name": "b.txt", "type": "file"},
+			map[string]interface{}{"id": 3, "name": "videos", "type": "folder"},
+		},
+		"3": {
+			map[string]interface{}{"id": 4, "name": "c.mp4", "type": "file"},
+			map[string]interface{}{"id": 5, "name": "d.mkv", "type": "file"},
+		},
+	}
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": tree[r.URL.Query().Get("folder_id")]}})
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	names := func(objs []model.Obj) string {
+		var names []string
+		for _, obj := range objs {
+			names = append(names, obj.GetName())
+		}
+		return strings.Join(names, ",")
+	}
+	for pattern, expect := range map[string]string{
+		"*.mp4":        "a.mp4",
+		"**/*.mp4":     "a.mp4,c.mp4",
+		"videos/*.mkv": "d.mkv",
+	} {
+		objs, err := d.Glob(context.Background(), dir, pattern)
+		if err != nil {
+			t.Fatalf("failed to glob %s: %+v", pattern, err)
+		}
+		if got := names(objs); got != expect {
+			t.Errorf("glob %s: expect %s, got %s", pattern, expect, got)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.Glob(ctx, dir, "**"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect canceled glob to fail, got %+v", err)
+	}
+}
+
+func TestBatchRename(t *testing.T) {
+	calls := 0
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/czkapi/batch_rename" {
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			return
+		}
+		var items []BatchItem
+		_ = json.Unmarshal([]byte(r.FormValue("items")), &items)
+		var results []interface{}
+		for _, item := range items {
+			if item.NewName != "new_"+item.ID {
+				t.Errorf("unexpected new name %q for %s", item.NewName, item.ID)
+			}
+			results = append(results, map[string]interface{}{"id": item.ID, "success": item.ID != "4"})
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": results}})
+	}))
+	d.cacheItem(&Object{Object: model.Object{ID: "2", Name: "dir", IsFolder: true}})
+	renamed, err := d.BatchRename(context.Background(), map[string]string{"1": "new_1", "2": "new_2", "3": "new_3"})
+	if err != nil {
+		t.Fatalf("failed to batch rename: %+v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expect a single request, got %d", calls)
+	}
+	if len(renamed) != 3 || renamed["2"].GetName() != "new_2" || !renamed["2"].IsDir() {
+		t.Errorf("unexpected renamed objects: %+v", renamed)
+	}
+
+	if _, err := d.BatchRename(context.Background(), map[string]string{"4": "new_4"}); err == nil || err.Error() != "rename 4: item 4 failed" {
+		t.Errorf("expect a generic reason for a failure without a message, got %v", err)
+	}
+}
+
+func TestBatchRenameEnvelopeError(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 500})
+	}))
+	_, err := d.BatchRename(context.Background(), map[string]string{"1": "new_1"})
+	if err == nil || !strings.Contains(err.Error(), "batch rename API error: code=500, message=unknown error") {
+		t.Errorf("expect a readable error for a failure without a message, got %v", err)
+	}
+}
+
+func TestWarmDownloadLink(t *testing.T) {
+	warmed := make(chan string, 1)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"status": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f"}})
+		case "/f":
+			warmed <- r.Method + " " + r.Host
+		}
+	}))
+	d.WarmDownloadLink = true
+	if _, err := d.Link(context.Background(), &model.Object{ID: "1"}, model.LinkArgs{}); err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	select {
+	case got := <-warmed:
+		if got != "HEAD cdn.example.com" {
+			t.Errorf("expect HEAD to the download host, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("expect a HEAD request to warm the download link")
+	}
+}
+
+func TestMoveSameParent(t *testing.T) {
+	calls := 0
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+	}))
+	src := &Object{Object: model.Object{ID: "5", Name: "a.txt"}, ParentID: "10"}
+	obj, err := d.Move(context.Background(), src, &model.Object{ID: "10", IsFolder: true})
+	if err != nil {
+		t.Fatalf("failed to move: %+v", err)
+	}
+	if obj != src || calls != 0 {
+		t.Errorf("expect same-parent move to be a no-op, got %+v with %d calls", obj, calls)
+	}
+
+	obj, err = d.Move(context.Background(), src, &model.Object{ID: "11", IsFolder: true})
+	if err != nil {
+		t.Fatalf("failed to move: %+v", err)
+	}
+	if calls != 1 || obj.(*Object).ParentID != "11" {
+		t.Errorf("expect move to a new parent to be sent, got %+v with %d calls", obj, calls)
+	}
+}
+
+func TestKeepTokenWarm(t *testing.T) {
+	defer func(v time.Duration) { tokenWarmMinInterval = v }(tokenWarmMinInterval)
+	tokenWarmMinInterval = 10 * time.Millisecond
+	refreshed := make(chan struct{}, 10)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/czkapi/refresh_token" {
+			refreshed <- struct{}{}
+		}
+		writeJSON(w, map[string]interface{}{
+			"status": 200, "success": true,
+			"data": map[string]interface{}{"access_token": "warm", "expires_in": 0},
+		})
+	}))
+	d.ExpiresAt = time.Now()
+	d.startTokenWarmer()
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect the token to be refreshed in the background")
+	}
+	done := d.warmerDone
+	if err := d.Drop(context.Background()); err != nil {
+		t.Fatalf("failed to drop: %+v", err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Errorf("expect the warmer goroutine to exit on Drop")
+	}
+}
+
+func TestListSetsPath(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{"items": listItems(1, 2)},
+		})
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "7", Path: "/media/videos", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	for _, obj := range objs {
+		if want := "/media/videos/" + obj.GetName(); obj.GetPath() != want {
+			t.Errorf("expect path %q, got %q", want, obj.GetPath())
+		}
+	}
+	objs, err = d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) == 0 || objs[0].GetPath() != "/"+objs[0].GetName() {
+		t.Errorf("expect root-relative path for root listing, got %+v", objs)
+	}
+}
+
+func TestListRecent(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/recent_files" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.URL.Query().Get("limit"); got != "2" {
+			t.Errorf("unexpected limit: %q", got)
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"id": 11, "name": "new.mp4", "type": "file", "parent_id": 3, "path": "/videos/new.mp4"},
+					map[string]interface{}{"id": 12, "name": "notes.txt", "type": "file", "parent_id": "0", "path": "/notes.txt"},
+					map[string]interface{}{"id": 13, "name": "extra.txt", "type": "file", "parent_id": 0, "path": "/extra.txt"},
+				},
+			},
+		})
+	}))
+	objs, err := d.ListRecent(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("failed to list recent files: %+v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expect 2 recent files, got %d", len(objs))
+	}
+	if pid, _ := d.parentOf(objs[0]); objs[0].GetID() != "11" || objs[0].GetPath() != "/videos/new.mp4" || pid != "3" {
+		t.Errorf("unexpected first recent file: %+v", objs[0])
+	}
+	if pid, _ := d.parentOf(objs[1]); objs[1].GetPath() != "/notes.txt" || pid != "0" {
+		t.Errorf("unexpected second recent file: %+v", objs[1])
+	}
+
+	d = newTestDriver(t, http.NotFoundHandler())
+	if _, err := d.ListRecent(context.Background(), 10); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport, got %v", err)
+	}
+}
+
+func TestSignRequests(t *testing.T) {
+	var signed bool
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Timestamp")
+		if timestamp != "" {
+			signed = r.Header.Get("X-Signature") == signPayload("api-secret", timestamp, r.URL.Path, body)
+		}
+		writeJSON(w, map[string]interface{}{"code": 200})
+	}))
+	d.APISecret = "api-secret"
+	d.SignRequests = true
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("folder_name", "docs")
+	_ = writer.Close()
+	if _, err := d.postForm(context.Background(), "https://pan.szczk.top/czkapi/create_folder", writer, payload); err != nil {
+		t.Fatalf("failed to post form: %+v", err)
+	}
+	if !signed {
+		t.Errorf("expect request to carry a valid signature")
+	}
+}
+
+func TestTruncatedResponseRetry(t *testing.T) {
+	var calls int
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			_, _ = w.Write([]byte(`{"code":200,"data":{"fold`))
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 9}})
+	}))
+	obj, err := d.MakeDir(context.Background(), &model.Object{ID: "0", IsFolder: true}, "docs")
+	if err != nil {
+		t.Fatalf("failed to make dir: %+v", err)
+	}
+	if calls != 2 || obj.GetID() != "9" {
+		t.Errorf("expect a retry after the truncated response, got %d calls and %+v", calls, obj)
+	}
+
+	d = newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":200,"data":{"fold`))
+	}))
+	if _, err := d.MakeDir(context.Background(), &model.Object{ID: "0", IsFolder: true}, "docs"); !errors.Is(err, ErrTruncatedResponse) {
+		t.Errorf("expect truncated response error, got %v", err)
+	}
+}
+
+func TestSetNote(t *testing.T) {
+	var form map[string]string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{
+				"code": 200,
+				"data": map[string]interface{}{"items": []interface{}{
+					map[string]interface{}{"id": 5, "name": "a.txt", "type": "file", "note": "draft"},
+				}},
+			})
+		case "/czkapi/set_note":
+			form = map[string]string{"id": r.FormValue("id"), "type": r.FormValue("type"), "note": r.FormValue("note")}
+			writeJSON(w, map[string]interface{}{"code": 200})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 1 || objs[0].(*Object).Note != "draft" {
+		t.Fatalf("expect listed object to carry its note, got %+v", objs)
+	}
+	if err := d.SetNote(context.Background(), objs[0], "final 版本"); err != nil {
+		t.Fatalf("failed to set note: %+v", err)
+	}
+	if fmt.Sprint(form) != "map[id:5 note:final 版本 type:file]" {
+		t.Errorf("unexpected set note payload: %v", form)
+	}
+	if cached, _ := d.cachedItem("5"); cached.Note != "final 版本" {
+		t.Errorf("expect cached note to be updated, got %q", cached.Note)
+	}
+	if err := d.SetNote(context.Background(), objs[0], strings.Repeat("长", maxNoteLength+1)); err == nil {
+		t.Errorf("expect an error for a note over the length limit")
+	}
+	if err := d.SetNote(context.Background(), &model.Object{ID: "9", IsFolder: true}, "x"); err != nil {
+		t.Fatalf("failed to set folder note: %+v", err)
+	}
+	if form["type"] != "folder" {
+		t.Errorf("expect folder type, got %v", form)
+	}
+
+	d = newTestDriver(t, http.NotFoundHandler())
+	if err := d.SetNote(context.Background(), objs[0], "x"); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport, got %v", err)
+	}
+}
+
+func TestRelistAfterPut(t *testing.T) {
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/ok_upload":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{
+				"code": 200,
+				"data": map[string]interface{}{"items": []interface{}{
+					map[string]interface{}{"id": 7, "name": "a.txt", "type": "file", "size": 3, "uploaded_at": "2025-06-29 15:37:01"},
+					map[string]interface{}{"id": 8, "name": "a.txt", "type": "file", "size": 5, "uploaded_at": "2025-06-30 08:00:00"},
+				}},
+			})
+		default:
+			upload(w, r)
+		}
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	// 响应中没有 file_id 时即使未开启 RelistAfterPut 也会查找刚上传的文件
+	for _, relist := range []bool{false, true} {
+		d.RelistAfterPut = relist
+		obj, err := d.Put(context.Background(), dir, newTestStream("a.txt", []byte("hello")), func(float64) {})
+		if err != nil {
+			t.Fatalf("failed to put: %+v", err)
+		}
+		if obj.GetID() != "8" || obj.ModTime().Format("2006-01-02 15:04:05") != "2025-06-30 08:00:00" {
+			t.Errorf("RelistAfterPut=%v: expect the re-listed object, got %+v", relist, obj)
+		}
+	}
+}
+
+func TestPutResumeOffset(t *testing.T) {
+	content := []byte("0123456789abcdef")
+	var received interface{}
+	var contentRange string
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/first_upload":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+				"csrf_token": "csrf", "file_key": "key", "upload_url": "https://upload.example.com/upload/key", "received_bytes": received,
+			}})
+		case "/upload/key":
+			contentRange = r.Header.Get("Content-Range")
+			upload(w, r)
+		default:
+			upload(w, r)
+		}
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+
+	received = 10
+	if _, err := d.Put(context.Background(), dir, newTestStream("a.bin", content), func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if string(rec.body) != "abcdef" || contentRange != "bytes 10-15/16" {
+		t.Errorf("expect only the bytes after the server offset, got %q with range %q", rec.body, contentRange)
+	}
+
+	rec.uploaded = false
+	received = "16"
+	if _, err := d.Put(context.Background(), dir, newTestStream("a.bin", content), func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if rec.uploaded {
+		t.Errorf("expect no body upload once the server has every byte")
+	}
+
+	received = 17
+	if _, err := d.Put(context.Background(), dir, newTestStream("a.bin", content), func(float64) {}); !errors.Is(err, ErrUploadOffset) {
+		t.Errorf("expect ErrUploadOffset for an offset beyond the file size, got %v", err)
+	}
+}
+
+func TestPutChunked(t *testing.T) {
+	defer func(delay time.Duration) { chunkRetryBaseDelay = delay }(chunkRetryBaseDelay)
+	chunkRetryBaseDelay = time.Millisecond
+	content := bytes.Repeat([]byte("0123456789abcdef"), 5<<16) // 5 MB
+	var ranges []string
+	var assembled []byte
+	failed := false
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upload/key" {
+			upload(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		// 第二个分片第一次发送失败
+		if len(ranges) == 1 && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Content-Range"))
+		assembled = append(assembled, body...)
+	}))
+	d.UploadChunkSize = 2
+	var progress []float64
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("big.bin", content), func(p float64) { progress = append(progress, p) }); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	expect := []string{"bytes 0-2097151/5242880", "bytes 2097152-4194303/5242880", "bytes 4194304-5242879/5242880"}
+	if strings.Join(ranges, ",") != strings.Join(expect, ",") {
+		t.Errorf("expect ranges %v, got %v", expect, ranges)
+	}
+	if !failed || !bytes.Equal(assembled, content) {
+		t.Errorf("expect the failed chunk to be retried and the content to be reassembled")
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 100 {
+		t.Errorf("expect progress to reach 100, got %v", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Errorf("expect progress to never go backwards, got %v", progress)
+			break
+		}
+	}
+}
+
+func TestPutFileID(t *testing.T) {
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	var lookups []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/ok_upload":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"file_id": "1234", "uploaded_at": "2025-07-01 10:00:00"}})
+		case "/czkapi/list_files":
+			lookups = append(lookups, r.URL.Query().Get("name_contains"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		default:
+			upload(w, r)
+		}
+	}))
+	obj, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.txt", []byte("hello")), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if obj.GetID() != "1234" || obj.ModTime().Format("2006-01-02 15:04:05") != "2025-07-01 10:00:00" {
+		t.Errorf("expect the id and upload time from ok_upload, got %+v", obj)
+	}
+	if len(lookups) != 0 {
+		t.Errorf("expect no lookup when ok_upload returns the id, got %v", lookups)
+	}
+}
+
+func TestPutRapidUpload(t *testing.T) {
+	var paths []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/czkapi/first_upload" {
+			t.Errorf("unexpected request after a rapid upload: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"rapid": true, "file_id": 77, "uploaded_at": "2025-07-01 10:00:00"}})
+	}))
+	obj, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.txt", []byte("hello")), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if obj.GetID() != "77" || obj.GetSize() != 5 || obj.ModTime().Format("2006-01-02 15:04:05") != "2025-07-01 10:00:00" {
+		t.Errorf("expect the object from first_upload, got %+v", obj)
+	}
+	if len(paths) != 1 {
+		t.Errorf("expect only first_upload to be called, got %v", paths)
+	}
+}
+
+func TestPutNonASCIIName(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	const name = "星辰云盘 测试报告（终稿）.txt"
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream(name, []byte("hello")), func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if rec.first["filename"] != name || rec.complete["filename"] != name {
+		t.Errorf("expect filename to round-trip as UTF-8, got %q and %q", rec.first["filename"], rec.complete["filename"])
+	}
+}
+
+func TestConcurrentTokenRenewal(t *testing.T) {
+	var issued atomic.Int64
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/refresh_token":
+			n := issued.Add(1)
+			writeJSON(w, map[string]interface{}{
+				"status": 200, "success": true,
+				"data": map[string]interface{}{"access_token": fmt.Sprintf("access-%d", n), "refresh_token": fmt.Sprintf("refresh-%d", n), "expires_in": 3600},
+			})
+		case "/czkapi/list_files":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer access-") {
+				t.Errorf("unexpected authorization header: %q", r.Header.Get("Authorization"))
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+		case "/czkapi/revoke_token":
+			writeJSON(w, map[string]interface{}{"code": 200})
+		}
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := d.List(context.Background(), dir, model.ListArgs{}); err != nil {
+				t.Errorf("failed to list: %+v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := d.renewToken(context.Background(), "test", d.accessToken()); err != nil {
+				t.Errorf("failed to renew token: %+v", err)
+			}
+		}
+	}()
+	wg.Wait()
+	if err := d.revokeToken(context.Background()); err != nil {
+		t.Fatalf("failed to revoke token: %+v", err)
+	}
+	if d.accessToken() != "" {
+		t.Errorf("expect the token to be cleared after revoke")
+	}
+}
+
+func TestTokenStatus(t *testing.T) {
+	tokenResp := func(w http.ResponseWriter, token string) {
+		writeJSON(w, map[string]interface{}{
+			"status": 200, "success": true,
+			"data": map[string]interface{}{"access_token": token, "refresh_token": "refresh-token", "expires_in": 3600},
+		})
+	}
+	newDriver := func(authOK bool) *CZK {
+		return newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/list_files":
+				if r.Header.Get("Authorization") != "Bearer access-token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+			case "/czkapi/refresh_token", "/czkapi/authenticate":
+				if !authOK {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				tokenResp(w, "access-token")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		d := newDriver(true)
+		valid, expiresIn, err := d.TokenStatus(context.Background())
+		if err != nil || !valid || expiresIn <= 50*time.Minute {
+			t.Errorf("expect a valid token, got valid=%v expiresIn=%v err=%v", valid, expiresIn, err)
+		}
+	})
+	t.Run("refreshable", func(t *testing.T) {
+		d := newDriver(true)
+		d.AccessToken = "revoked"
+		valid, expiresIn, err := d.TokenStatus(context.Background())
+		if err != nil || !valid || expiresIn <= 0 || d.AccessToken != "access-token" {
+			t.Errorf("expect the token to be refreshed, got valid=%v expiresIn=%v err=%v", valid, expiresIn, err)
+		}
+	})
+	t.Run("unrecoverable", func(t *testing.T) {
+		defer func(v time.Duration) { authRetryBaseDelay = v }(authRetryBaseDelay)
+		authRetryBaseDelay = time.Millisecond
+		d := newDriver(false)
+		d.ExpiresAt = time.Now().Add(-time.Minute)
+		valid, _, err := d.TokenStatus(context.Background())
+		if valid || err == nil {
+			t.Errorf("expect an unrecoverable token state, got valid=%v err=%v", valid, err)
+		}
+	})
+}
+
+func TestInitSavedToken(t *testing.T) {
+	var calls []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, path.Base(r.URL.Path))
+		switch r.URL.Path {
+		case "/czkapi/authenticate", "/czkapi/refresh_token":
+			if r.FormValue("refresh_token") == "revoked" {
+				w.WriteHeader(http.StatusUnauthorized)
+				writeJSON(w, map[string]interface{}{"status": 401, "success": false, "message": "invalid token"})
+				return
+			}
+			writeJSON(w, map[string]interface{}{
+				"status": 200, "success": true,
+				"data": map[string]interface{}{"access_token": "fresh-" + path.Base(r.URL.Path), "refresh_token": "refresh-new", "expires_in": 3600},
+			})
+		case "/czkapi/list_files":
+			if r.Header.Get("Authorization") == "Bearer revoked" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	valid := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name         string
+		saved        string
+		savedRefresh string
+		expiry       int64
+		key          string
+		expectCalls  string
+		expectToken  string
+	}{
+		{"valid", "saved", "refresh-old", valid, "key", "list_files", "saved"},
+		{"expired", "saved", "refresh-old", time.Now().Add(-time.Minute).Unix(), "key", "refresh_token,list_files", "fresh-refresh_token"},
+		{"other key", "saved", "refresh-old", valid, "old-key", "authenticate", "fresh-authenticate"},
+		{"cleared", "", "", 0, "key", "authenticate", "fresh-authenticate"},
+		{"revoked", "revoked", "refresh-old", valid, "key", "list_files,refresh_token", "fresh-refresh_token"},
+		{"revoked refresh", "revoked", "revoked", valid, "key", "list_files,refresh_token,authenticate", "fresh-authenticate"},
+	}
+	for _, tt := range tests {
+		calls = nil
+		d := &CZK{}
+		d.APIKey, d.APISecret = "key", "secret"
+		d.BaseURL, d.CACertPEM, d.RootFolderID = srv.URL+"/czkapi", caPEM, "0"
+		d.SavedAccessToken, d.SavedRefreshToken, d.SavedTokenExpiry, d.SavedTokenKey = tt.saved, tt.savedRefresh, tt.expiry, tt.key
+		if err := d.Init(context.Background()); err != nil {
+			t.Fatalf("%s: failed to init: %+v", tt.name, err)
+		}
+		if got := strings.Join(calls, ","); got != tt.expectCalls {
+			t.Errorf("%s: expect calls %s, got %s", tt.name, tt.expectCalls, got)
+		}
+		if d.AccessToken != tt.expectToken || d.SavedAccessToken != tt.expectToken || d.SavedTokenKey != "key" {
+			t.Errorf("%s: expect token %s to be in use and saved, got %s / %s", tt.name, tt.expectToken, d.AccessToken, d.SavedAccessToken)
+		}
+	}
+}
+
+var testDBOnce sync.Once
+
+// setupTestDB 初始化内存数据库，用于经由 op 层创建和更新存储的测试
+func setupTestDB() {
+	testDBOnce.Do(func() {
+		dB, err := gorm.Open(sqlite.Open("file:czk?mode=memory&cache=shared"), &gorm.Config{})
+		if err != nil {
+			panic("failed to connect database")
+		}
+		conf.Conf = conf.DefaultConfig("data")
+		db.Init(dB)
+	})
+}
+
+func TestStorageLifecycleTokens(t *testing.T) {
+	setupTestDB()
+	var mu sync.Mutex
+	issued := 0
+	revoked := map[string]bool{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/czkapi/authenticate", "/czkapi/refresh_token":
+			if r.URL.Path == "/czkapi/refresh_token" && revoked[r.FormValue("refresh_token")] {
+				w.WriteHeader(http.StatusUnauthorized)
+				writeJSON(w, map[string]interface{}{"status": 401, "success": false, "message": "invalid token"})
+				return
+			}
+			issued++
+			writeJSON(w, map[string]interface{}{
+				"status": 200, "success": true,
+				"data": map[string]interface{}{"access_token": fmt.Sprintf("access-%d", issued), "refresh_token": fmt.Sprintf("refresh-%d", issued), "expires_in": 3600},
+			})
+		case "/czkapi/revoke_token":
+			refresh := r.FormValue("refresh_token")
+			revoked[refresh] = true
+			revoked["access-"+strings.TrimPrefix(refresh, "refresh-")] = true
+			writeJSON(w, map[string]interface{}{"code": 200})
+		case "/czkapi/list_files":
+			if revoked[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	addition, _ := json.Marshal(map[string]interface{}{
+		"api_key":        "key",
+		"api_secret":     "secret",
+		"base_url":       srv.URL + "/czkapi",
+		"ca_cert_pem":    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})),
+		"root_folder_id": "0",
+	})
+	ctx := context.Background()
+	id, err := op.CreateStorage(ctx, model.Storage{Driver: config.Name, MountPath: "/czk-lifecycle", Addition: string(addition)})
+	if err != nil {
+		t.Fatalf("failed to create storage: %+v", err)
+	}
+	current := func(step string) *CZK {
+		t.Helper()
+		storage, err := op.GetStorageByMountPath("/czk-lifecycle")
+		if err != nil {
+			t.Fatalf("%s: failed to get storage: %+v", step, err)
+		}
+		d := storage.(*CZK)
+		if d.Status != op.WORK {
+			t.Fatalf("%s: expect the storage to work, got status %q", step, d.Status)
+		}
+		return d
+	}
+	if d := current("create"); d.AccessToken != "access-1" {
+		t.Fatalf("expect the first token after create, got %q", d.AccessToken)
+	}
+
+	// 禁用时 op 层写回 Drop 之前读取的配置，其中的令牌已被注销，启用后应重新换发
+	if err := op.DisableStorage(ctx, id); err != nil {
+		t.Fatalf("failed to disable storage: %+v", err)
+	}
+	if err := op.EnableStorage(ctx, id); err != nil {
+		t.Fatalf("failed to enable storage: %+v", err)
+	}
+	if d := current("enable"); d.AccessToken != "access-2" {
+		t.Errorf("expect a revoked saved token to be replaced on enable, got %q", d.AccessToken)
+	}
+
+	// 更新时用户修改后的配置先保存，随后 Drop 旧驱动，Drop 不应覆盖用户的修改
+	storage, err := db.GetStorageById(id)
+	if err != nil {
+		t.Fatalf("failed to get storage: %+v", err)
+	}
+	var edited map[string]interface{}
+	_ = json.Unmarshal([]byte(storage.Addition), &edited)
+	edited["max_pages"] = 7
+	editedJSON, _ := json.Marshal(edited)
+	storage.Addition = string(editedJSON)
+	if err := op.UpdateStorage(ctx, *storage); err != nil {
+		t.Fatalf("failed to update storage: %+v", err)
+	}
+	if d := current("update"); d.AccessToken != "access-3" || d.MaxPages != 7 {
+		t.Errorf("expect a fresh token and the edited config after update, got %q and max_pages %d", d.AccessToken, d.MaxPages)
+	}
+	if storage, err = db.GetStorageById(id); err != nil || !strings.Contains(storage.Addition, `"max_pages":7`) {
+		t.Errorf("expect the edit to be kept in the database, got %v, %v", storage, err)
+	}
+	if err := op.DeleteStorageById(ctx, id); err != nil {
+		t.Errorf("failed to delete storage: %+v", err)
+	}
+}
+
+func TestEmptyTokens(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"status": 200, "success": true, "message": "认证成功",
+			"data": map[string]interface{}{"access_token": "", "refresh_token": "", "expires_in": 3600},
+		})
+	}))
+	if err := d.authenticate(context.Background()); err == nil || !strings.Contains(err.Error(), "no access token returned") {
+		t.Errorf("expect a clear error for an empty access token, got %v", err)
+	}
+	if err := d.refreshToken(); err == nil || !strings.Contains(err.Error(), "no access token returned") {
+		t.Errorf("expect a clear error for an empty refreshed token, got %v", err)
+	}
+	if d.AccessToken != "access-token" {
+		t.Errorf("expect the current token to be kept, got %q", d.AccessToken)
+	}
+}
+
+func TestCopyChildren(t *testing.T) {
+	src := &model.Object{ID: "3", IsFolder: true}
+	dst := &model.Object{ID: "9", IsFolder: true}
+	listing := func(w http.ResponseWriter) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": listItems(1, 3)}})
+	}
+	t.Run("batch", func(t *testing.T) {
+		var items []BatchItem
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/list_files":
+				listing(w)
+			case "/czkapi/batch_copy":
+				_ = json.Unmarshal([]byte(r.FormValue("items")), &items)
+				if r.FormValue("target_id") != "9" {
+					t.Errorf("unexpected target_id: %q", r.FormValue("target_id"))
+				}
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": []interface{}{
+					map[string]interface{}{"id": 1, "success": true, "new_id": 101},
+					map[string]interface{}{"id": 3, "success": true, "new_id": 103},
+				}}})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		copied, err := d.CopyChildren(context.Background(), src, []string{"1", "3"}, dst)
+		if err != nil {
+			t.Fatalf("failed to copy children: %+v", err)
+		}
+		if fmt.Sprint(items) != "[{1 file  } {3 file  }]" {
+			t.Errorf("expect only the selected children to be sent, got %v", items)
+		}
+		if len(copied) != 2 || copied[0].GetID() != "101" || copied[1].GetName() != "3.txt" {
+			t.Errorf("unexpected copied objects: %+v", copied)
+		}
+	})
+	t.Run("failed without message", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/list_files":
+				listing(w)
+			case "/czkapi/batch_copy":
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": []interface{}{
+					map[string]interface{}{"id": 1, "success": false},
+				}}})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		_, err := d.CopyChildren(context.Background(), src, []string{"1", "3"}, dst)
+		if err == nil || !strings.Contains(err.Error(), "copy 1: item 1 failed") || !strings.Contains(err.Error(), "copy 3: item 3 failed: no result returned") {
+			t.Errorf("expect a generic reason for failures without a message, got %v", err)
+		}
+	})
+	t.Run("fallback", func(t *testing.T) {
+		var copiedIDs []string
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/list_files":
+				listing(w)
+			case "/czkapi/copy_item":
+				copiedIDs = append(copiedIDs, r.FormValue("id"))
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"new_id": 200}})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		copied, err := d.CopyChildren(context.Background(), src, []string{"2", "404"}, dst)
+		if !errors.Is(err, errs.ObjectNotFound) {
+			t.Errorf("expect ObjectNotFound for a child outside the source folder, got %v", err)
+		}
+		if fmt.Sprint(copiedIDs) != "[2]" || len(copied) != 1 || copied[0].GetID() != "200" {
+			t.Errorf("expect only child 2 to be copied, got %v and %+v", copiedIDs, copied)
+		}
+	})
+}
+
+func TestCopy(t *testing.T) {
+	var form url.Values
+	supported := true
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/copy_item" || !supported {
+			http.NotFound(w, r)
+			return
+		}
+		_ = r.ParseMultipartForm(1 << 20)
+		form = r.PostForm
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"new_id": "300"}})
+	}))
+	dst := &model.Object{ID: "9", Name: "backup", Path: "/backup", IsFolder: true}
+	obj, err := d.Copy(context.Background(), &model.Object{ID: "5", Name: "photos", IsFolder: true}, dst)
+	if err != nil {
+		t.Fatalf("failed to copy: %+v", err)
+	}
+	if form.Get("id") != "5" || form.Get("type") != "folder" || form.Get("target_id") != "9" {
+		t.Errorf("unexpected copy form: %v", form)
+	}
+	if obj.GetID() != "300" || !obj.IsDir() || obj.GetPath() != "/backup/photos" {
+		t.Errorf("expect the new folder from copy_item, got %+v", obj)
+	}
+	supported = false
+	if _, err := d.Copy(context.Background(), &model.Object{ID: "6", Name: "a.txt"}, dst); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport without the copy endpoint, got %v", err)
+	}
+}
+
+func TestBatchSetModTime(t *testing.T) {
+	times := map[string]time.Time{
+		"1": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2": time.Date(2021, 6, 7, 8, 9, 10, 0, time.FixedZone("CST", 8*3600)),
+	}
+	t.Run("batch", func(t *testing.T) {
+		var items string
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/czkapi/batch_set_mod_time" {
+				http.NotFound(w, r)
+				return
+			}
+			items = r.FormValue("items")
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": []map[string]interface{}{
+				{"id": 1, "success": true},
+				{"id": 2, "success": false, "msg": "无权限"},
+			}}})
+		}))
+		d.cacheItem(&Object{Object: model.Object{ID: "2", IsFolder: true}})
+		failed, err := d.BatchSetModTime(context.Background(), times)
+		if err != nil {
+			t.Fatalf("failed to set modified times: %+v", err)
+		}
+		expect := `[{"id":"1","type":"file","modified":"2020-01-02 03:04:05"},{"id":"2","type":"folder","modified":"2021-06-07 00:09:10"}]`
+		if items != expect {
+			t.Errorf("expect items %s, got %s", expect, items)
+		}
+		if len(failed) != 1 || failed["2"] == nil || !strings.Contains(failed["2"].Error(), "无权限") {
+			t.Errorf("expect only object 2 to fail, got %v", failed)
+		}
+	})
+	t.Run("failed without message", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"results": []map[string]interface{}{
+				{"id": 1, "success": false},
+			}}})
+		}))
+		failed, err := d.BatchSetModTime(context.Background(), times)
+		if err != nil {
+			t.Fatalf("failed to set modified times: %+v", err)
+		}
+		if failed["1"] == nil || failed["1"].Error() != "set modified time API error: item 1 failed" {
+			t.Errorf("expect a generic reason for object 1, got %v", failed["1"])
+		}
+		if failed["2"] == nil || failed["2"].Error() != "set modified time API error: item 2 failed: no result returned" {
+			t.Errorf("expect a missing result to be reported for object 2, got %v", failed["2"])
+		}
+	})
+	t.Run("fallback", func(t *testing.T) {
+		set := map[string]string{}
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/czkapi/set_mod_time" {
+				http.NotFound(w, r)
+				return
+			}
+			set[r.FormValue("id")] = r.FormValue("modified")
+			if r.FormValue("id") == "2" {
+				writeJSON(w, map[string]interface{}{"code": 404, "msg": "文件不存在"})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		}))
+		failed, err := d.BatchSetModTime(context.Background(), times)
+		if err != nil {
+			t.Fatalf("failed to set modified times: %+v", err)
+		}
+		if set["1"] != "2020-01-02 03:04:05" || set["2"] != "2021-06-07 00:09:10" {
+			t.Errorf("expect one request per object, got %v", set)
+		}
+		if len(failed) != 1 || failed["2"] == nil {
+			t.Errorf("expect only object 2 to fail, got %v", failed)
+		}
+	})
+}
+
+// unrewindableFile 模拟读取位置无法回退的缓存文件，Seek 不会移动读取位置
+type unrewindableFile struct {
+	*bytes.Reader
+}
+
+func (f unrewindableFile) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+func TestPutUnrewindableCache(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	content := []byte("hello world")
+	cached := bytes.NewReader(content)
+	_, _ = io.Copy(io.Discard, cached)
+	s := newTestStream("a.txt", content)
+	s.SetTmpFile(unrewindableFile{cached})
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, s, func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if !bytes.Equal(rec.body, content) {
+		t.Errorf("expect the full content to be uploaded, got %q", rec.body)
+	}
+}
+
+func TestListMatching(t *testing.T) {
+	items := []interface{}{
+		map[string]interface{}{"id": 1, "name": "Report-2024.pdf", "type": "file"},
+		map[string]interface{}{"id": 2, "name": "photo.jpg", "type": "file"},
+		map[string]interface{}{"id": 3, "name": "old reports", "type": "folder"},
+	}
+	dir := &model.Object{ID: "0", IsFolder: true}
+	t.Run("server", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("name_contains"); got != "REPORT" {
+				t.Errorf("unexpected name_contains: %q", got)
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{items[0], items[2]}}})
+		}))
+		objs, err := d.ListMatching(context.Background(), dir, "REPORT")
+		if err != nil {
+			t.Fatalf("failed to list matching: %+v", err)
+		}
+		if len(objs) != 2 || objs[0].GetID() != "1" || objs[1].GetID() != "3" {
+			t.Errorf("unexpected matches: %+v", objs)
+		}
+	})
+	t.Run("client", func(t *testing.T) {
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": items}})
+		}))
+		objs, err := d.ListMatching(context.Background(), dir, "REPORT")
+		if err != nil {
+			t.Fatalf("failed to list matching: %+v", err)
+		}
+		if len(objs) != 2 || objs[0].GetID() != "1" || objs[1].GetID() != "3" {
+			t.Errorf("expect client-side case-insensitive filtering, got %+v", objs)
+		}
+	})
+}
+
+func TestListModifiedBetween(t *testing.T) {
+	var query url.Values
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "before.txt", "type": "file", "uploaded_at": "2025-05-31 23:59:59"},
+			map[string]interface{}{"id": 2, "name": "start.txt", "type": "file", "uploaded_at": "2025-06-01 00:00:00"},
+			map[string]interface{}{"id": 3, "name": "docs", "type": "folder", "created_at": "2025-06-15 12:00:00"},
+			map[string]interface{}{"id": 4, "name": "end.txt", "type": "file", "uploaded_at": "2025-07-01 00:00:00"},
+			map[string]interface{}{"id": 5, "name": "undated.txt", "type": "file"},
+		}}})
+	}))
+	dir := &model.Object{ID: "0", IsFolder: true}
+	// 以东八区表示的边界与按UTC解析的修改时间比较同一时刻
+	cst := time.FixedZone("CST", 8*3600)
+	from := time.Date(2025, 6, 1, 8, 0, 0, 0, cst)
+	to := time.Date(2025, 7, 1, 8, 0, 0, 0, cst)
+	objs, err := d.ListModifiedBetween(context.Background(), dir, from, to)
+	if err != nil {
+		t.Fatalf("failed to list by modification time: %+v", err)
+	}
+	if query.Get("modified_from") != "2025-06-01 00:00:00" || query.Get("modified_to") != "2025-07-01 00:00:00" {
+		t.Errorf("unexpected range params: %v", query)
+	}
+	if len(objs) != 2 || objs[0].GetID() != "2" || objs[1].GetID() != "3" {
+		t.Errorf("expect the inclusive start and exclusive end, got %+v", objs)
+	}
+
+	objs, err = d.ListModifiedBetween(context.Background(), dir, time.Time{}, to)
+	if err != nil {
+		t.Fatalf("failed to list by modification time: %+v", err)
+	}
+	if query.Has("modified_from") || len(objs) != 3 {
+		t.Errorf("expect an open start bound, got params %v and %+v", query, objs)
+	}
+}
+
+func TestDropClearsSavedTokens(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/revoke_token" {
+			t.Errorf("unexpected request: %s", r.URL.Path)
+		}
+		writeJSON(w, map[string]interface{}{"code": 200})
+	}))
+	d.SavedAccessToken, d.SavedRefreshToken, d.SavedTokenExpiry, d.SavedTokenKey = "access-token", "refresh-token", time.Now().Add(time.Hour).Unix(), "key"
+	if err := d.Drop(context.Background()); err != nil {
+		t.Fatalf("failed to drop: %+v", err)
+	}
+	if d.AccessToken != "" || d.SavedAccessToken != "" || d.SavedRefreshToken != "" || d.SavedTokenExpiry != 0 {
+		t.Errorf("expect revoked tokens to be cleared from the config, got %q %q %d", d.SavedAccessToken, d.SavedRefreshToken, d.SavedTokenExpiry)
+	}
+	if d.restoreTokens() {
+		t.Errorf("expect no saved token to be restored after revoke")
+	}
+}
+
+func TestDropRevokeTimeout(t *testing.T) {
+	revoked := make(chan string, 2)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case revoked <- r.FormValue("refresh_token"):
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := d.Drop(ctx); err != nil {
+		t.Fatalf("failed to drop: %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect Drop to return within the ctx deadline, took %v", elapsed)
+	}
+	select {
+	case got := <-revoked:
+		if got != "refresh-token" {
+			t.Errorf("expect the refresh token to be revoked, got %q", got)
+		}
+	default:
+		t.Errorf("expect the refresh token to be revoked")
+	}
+
+	defer func(v time.Duration) { dropRevokeTimeout = v }(dropRevokeTimeout)
+	dropRevokeTimeout = 200 * time.Millisecond
+	start = time.Now()
+	if err := d.Drop(context.Background()); err != nil {
+		t.Fatalf("failed to drop: %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect Drop to bound the revoke call, took %v", elapsed)
+	}
+}
+
+func TestMoveFolderInvalidatesSubtree(t *testing.T) {
+	tree := map[string][]interface{}{
+		"0": {
+			map[string]interface{}{"id": 3, "name": "videos", "type": "folder"},
+			map[string]interface{}{"id": 9, "name": "archive", "type": "folder"},
+		},
+		"3": {map[string]interface{}{"id": 4, "name": "clips", "type": "folder"}},
+		"4": {map[string]interface{}{"id": 5, "name": "a.mp4", "type": "file"}},
+	}
+	listed := map[string]int{}
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			folderID := r.URL.Query().Get("folder_id")
+			listed[folderID]++
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": tree[folderID]}})
+		case "/czkapi/move_item":
+			writeJSON(w, map[string]interface{}{"code": 200})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.MountPath = "/czk-subtree-test"
+	d.CacheExpiration = 10
+	d.RootFolderID = "0"
+	ctx := context.Background()
+	if _, err := op.List(ctx, d, "/videos/clips", model.ListArgs{}); err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	videos, err := op.Get(ctx, d, "/videos")
+	if err != nil {
+		t.Fatalf("failed to get folder: %+v", err)
+	}
+	if _, ok := d.cachedItem("5"); !ok {
+		t.Fatalf("expect descendants to be cached before the move")
+	}
+	if _, err := d.Move(ctx, model.UnwrapObj(videos), &model.Object{ID: "9", Path: "/archive", IsFolder: true}); err != nil {
+		t.Fatalf("failed to move: %+v", err)
+	}
+	if _, ok := d.cachedItem("5"); ok {
+		t.Errorf("expect cached descendants to be invalidated after the move")
+	}
+	if _, ok := d.cachedItem("9"); !ok {
+		t.Errorf("expect items outside the moved subtree to stay cached")
+	}
+	if _, err := op.List(ctx, d, "/videos/clips", model.ListArgs{}); err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if listed["0"] != 1 || listed["3"] != 2 || listed["4"] != 2 {
+		t.Errorf("expect the moved subtree to be re-listed, got %v", listed)
+	}
+}
+
+func TestListHashes(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "a.txt", "type": "file", "md5": "5d41402abc4b2a76b9719d911017c592", "sha1": "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+			map[string]interface{}{"id": 2, "name": "b.txt", "type": "file", "hash": "7d793037a0760186574b0282f2f435e7"},
+			map[string]interface{}{"id": 3, "name": "c.txt", "type": "file"},
+		}}})
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if got := objs[0].GetHash(); got.GetHash(utils.MD5) != "5d41402abc4b2a76b9719d911017c592" || got.GetHash(utils.SHA1) != "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d" {
+		t.Errorf("unexpected hashes for a.txt: %v", got)
+	}
+	if got := objs[1].GetHash().GetHash(utils.MD5); got != "7d793037a0760186574b0282f2f435e7" {
+		t.Errorf("expect hash field to be used as MD5, got %q", got)
+	}
+	if got := objs[2].GetHash().GetHash(utils.MD5); got != "" {
+		t.Errorf("expect no hash for c.txt, got %q", got)
+	}
+}
+
+func TestNormalizeNames(t *testing.T) {
+	const nfd, nfc = "cafe\u0301", "caf\u00e9"
+	var sent []string
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/create_folder":
+			sent = append(sent, r.FormValue("name"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 9}})
+		case "/czkapi/rename_item":
+			sent = append(sent, r.FormValue("new_name"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 1, "name": nfd + ".txt", "type": "file"},
+			}}})
+		default:
+			upload(w, r)
+		}
+	}))
+	d.NormalizeNames = true
+	ctx := context.Background()
+	dir := &model.Object{ID: "0", IsFolder: true}
+	if _, err := d.MakeDir(ctx, dir, nfd); err != nil {
+		t.Fatalf("failed to make dir: %+v", err)
+	}
+	if _, err := d.Rename(ctx, &model.Object{ID: "1"}, nfd+".txt"); err != nil {
+		t.Fatalf("failed to rename: %+v", err)
+	}
+	if _, err := d.Put(ctx, dir, newTestStream(nfd+".bin", []byte("x")), func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	sent = append(sent, rec.first["filename"])
+	expect := []string{nfc, nfc + ".txt", nfc + ".bin"}
+	if strings.Join(sent, "|") != strings.Join(expect, "|") {
+		t.Errorf("expect NFC names to be sent, got %q", sent)
+	}
+	objs, err := d.List(ctx, dir, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != nfc+".txt" {
+		t.Errorf("expect listed names to be normalized, got %+v", objs)
+	}
+}
+
+func TestMakeDirRace(t *testing.T) {
+	var mu sync.Mutex
+	var created []interface{}
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/czkapi/create_folder":
+			if len(created) > 0 {
+				writeJSON(w, map[string]interface{}{"code": 409, "msg": "文件夹已存在"})
+				return
+			}
+			created = append(created, map[string]interface{}{"id": 77, "name": r.FormValue("name"), "type": "folder"})
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 77}})
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": created}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.ReuseExistingFolder = true
+	dir := &model.Object{ID: "0", IsFolder: true}
+	ids := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			obj, err := d.MakeDir(context.Background(), dir, "shared")
+			if err != nil {
+				t.Errorf("failed to make dir: %+v", err)
+				return
+			}
+			ids[i] = obj.GetID()
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != "77" {
+			t.Errorf("expect every caller to get folder 77, got %v", ids)
+			break
+		}
+	}
+
+	d.ReuseExistingFolder = false
+	if _, err := d.MakeDir(context.Background(), dir, "shared"); err == nil {
+		t.Errorf("expect an error for an existing folder when reuse is disabled")
+	}
+}
+
+func TestFileStats(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/file_stats" || r.URL.Query().Get("file_id") != "5" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+			"download_count": 12, "last_accessed": "2025-07-01 09:30:00", "share_count": 3,
+		}})
+	}))
+	stats, err := d.FileStats(context.Background(), &model.Object{ID: "5"})
+	if err != nil {
+		t.Fatalf("failed to get file stats: %+v", err)
+	}
+	if stats.DownloadCount != 12 || stats.ShareCount != 3 || stats.LastAccessed.Format("2006-01-02 15:04:05") != "2025-07-01 09:30:00" {
+		t.Errorf("unexpected file stats: %+v", stats)
+	}
+	if _, err := d.FileStats(context.Background(), &model.Object{ID: "6"}); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport, got %v", err)
+	}
+}
+
+func TestGetShareLink(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/list_shares" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		switch q.Get("id") + "/" + q.Get("type") {
+		case "5/file":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"shares": []map[string]interface{}{
+				{"share_id": 1, "share_url": "/s/old", "status": "cancelled"},
+				{"share_id": 2, "share_url": "/s/expired", "status": "active", "expires_at": "2000-01-01 00:00:00"},
+				{"share_id": 3, "share_url": "/s/abc", "password": "x7k2", "status": "active", "expires_at": "2099-01-01 00:00:00"},
+			}}})
+		case "6/folder":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"shares": []interface{}{}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	share, err := d.GetShareLink(context.Background(), &model.Object{ID: "5"})
+	if err != nil {
+		t.Fatalf("failed to get share link: %+v", err)
+	}
+	if share.ID != "3" || share.URL != "https://pan.szczk.top/s/abc" || share.Password != "x7k2" || share.ExpiresAt.Year() != 2099 {
+		t.Errorf("expect the first active share, got %+v", share)
+	}
+	if _, err := d.GetShareLink(context.Background(), &model.Object{ID: "6", IsFolder: true}); !errors.Is(err, errs.ObjectNotFound) {
+		t.Errorf("expect ObjectNotFound without an active share, got %v", err)
+	}
+	if _, err := d.GetShareLink(context.Background(), &model.Object{ID: "7"}); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport, got %v", err)
+	}
+}
+
+func TestBatchThumbs(t *testing.T) {
+	batch := true
+	var requested string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/batch_thumbnails":
+			if !batch {
+				http.NotFound(w, r)
+				return
+			}
+			requested = r.FormValue("ids")
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"thumbnails": []map[string]interface{}{
+				{"id": 1, "thumbnail_url": "/thumbs/1.jpg"},
+				{"id": "2", "thumbnail_url": "https://cdn.example.com/thumbs/2.jpg"},
+			}}})
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f/" + r.URL.Query().Get("file_id")}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	files := []model.Obj{
+		&model.Object{ID: "1", Name: "a.jpg"},
+		&model.Object{ID: "2", Name: "b.png"},
+		&model.Object{ID: "3", Name: "c.txt"},
+		&model.Object{ID: "4", Name: "photos", IsFolder: true},
+	}
+	thumbs, err := d.BatchThumbs(context.Background(), files)
+	if err != nil {
+		t.Fatalf("failed to get thumbnails: %+v", err)
+	}
+	if requested != `["1","2","3"]` {
+		t.Errorf("expect only files in a single request, got %s", requested)
+	}
+	if len(thumbs) != 2 || thumbs["1"] != "https://pan.szczk.top/thumbs/1.jpg" || thumbs["2"] != "https://cdn.example.com/thumbs/2.jpg" {
+		t.Errorf("expect thumbnails for files 1 and 2, got %v", thumbs)
+	}
+
+	batch = false
+	thumbs, err = d.BatchThumbs(context.Background(), files[:2])
+	if err != nil {
+		t.Fatalf("failed to get thumbnails: %+v", err)
+	}
+	if thumbs["1"] != "https://cdn.example.com/f/1" || thumbs["2"] != "https://cdn.example.com/f/2" {
+		t.Errorf("expect per-file links without the batch endpoint, got %v", thumbs)
+	}
+}
+
+func TestOfflineCancel(t *testing.T) {
+	var cancelled, deleted []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/offline_cancel":
+			taskID := r.FormValue("task_id")
+			cancelled = append(cancelled, taskID)
+			if taskID == "done" {
+				writeJSON(w, map[string]interface{}{"code": offlineTaskFinishedCode, "msg": "任务已完成"})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"partial_file_id": 77}})
+		case "/czkapi/delete_item":
+			deleted = append(deleted, r.FormValue("id")+"/"+r.FormValue("type"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	if err := d.OfflineCancel(context.Background(), "t1"); err != nil {
+		t.Fatalf("failed to cancel offline task: %+v", err)
+	}
+	if err := d.OfflineCancel(context.Background(), "done"); err != nil {
+		t.Errorf("expect cancelling a finished task to succeed, got %v", err)
+	}
+	if strings.Join(cancelled, ",") != "t1,done" {
+		t.Errorf("expect the cancel endpoint to be called for each task, got %v", cancelled)
+	}
+	if len(deleted) != 1 || deleted[0] != "77/file" {
+		t.Errorf("expect only the partial file of the running task to be removed, got %v", deleted)
+	}
+}
+
+func TestPutCompleteProcessingRetry(t *testing.T) {
+	defer func(v time.Duration) { completeRetryBaseDelay = v }(completeRetryBaseDelay)
+	completeRetryBaseDelay = time.Millisecond
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	var completions []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/ok_upload" {
+			upload(w, r)
+			return
+		}
+		completions = append(completions, r.FormValue("file_key"))
+		switch len(completions) {
+		case 1:
+			w.WriteHeader(http.StatusAccepted)
+		case 2:
+			writeJSON(w, map[string]interface{}{"code": uploadProcessingCode, "msg": "处理中"})
+		default:
+			upload(w, r)
+		}
+	}))
+	obj, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.txt", []byte("hello")), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if obj.GetID() != "42" || fmt.Sprint(completions) != "[key key key]" {
+		t.Errorf("expect completion to be retried with the same file_key, got %v and %+v", completions, obj)
+	}
+
+	completions = nil
+	d = newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/ok_upload" {
+			upload(w, r)
+			return
+		}
+		completions = append(completions, r.FormValue("file_key"))
+		writeJSON(w, map[string]interface{}{"code": 500, "msg": "hash mismatch"})
+	}))
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.txt", []byte("hello")), func(float64) {}); err == nil || len(completions) != 1 {
+		t.Errorf("expect a hard error without retrying, got %v after %d completions", err, len(completions))
+	}
+}
+
+func TestPutToPath(t *testing.T) {
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	tree := map[string][]interface{}{
+		"0": {
+			map[string]interface{}{"id": 1, "name": "backup", "type": "folder"},
+			map[string]interface{}{"id": 5, "name": "notes.txt", "type": "file"},
+		},
+	}
+	var mkdirs []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": tree[r.URL.Query().Get("folder_id")]}})
+		case "/czkapi/create_folder":
+			mkdirs = append(mkdirs, r.FormValue("parent_id")+"/"+r.FormValue("name"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 10 + len(mkdirs)}})
+		default:
+			upload(w, r)
+		}
+	}))
+	d.RootFolderID = "0"
+	s := newTestStream("a.txt", []byte("hello"))
+	if _, err := d.PutToPath(context.Background(), "/backup/2025/07", s, func(float64) {}); !errors.Is(err, errs.ObjectNotFound) {
+		t.Errorf("expect ObjectNotFound without CreateParentFolders, got %v", err)
+	}
+	if _, err := d.PutToPath(context.Background(), "/notes.txt/x", s, func(float64) {}); !errors.Is(err, errs.NotFolder) {
+		t.Errorf("expect NotFolder for a file in the path, got %v", err)
+	}
+	d.CreateParentFolders = true
+	obj, err := d.PutToPath(context.Background(), "/backup/2025/07", newTestStream("a.txt", []byte("hello")), func(float64) {})
+	if err != nil {
+		t.Fatalf("failed to put to path: %+v", err)
+	}
+	if fmt.Sprint(mkdirs) != "[1/2025 11/07]" {
+		t.Errorf("expect missing folders to be created in order, got %v", mkdirs)
+	}
+	if rec.complete["folder"] != "12" || obj.GetID() != "42" {
+		t.Errorf("expect the file to land in folder 12, got folder %q and %+v", rec.complete["folder"], obj)
+	}
+}
+
+func TestBodyErrorOnHTTP200(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			if r.URL.Query().Get("file_id") == "2" {
+				w.WriteHeader(http.StatusForbidden)
+				writeJSON(w, map[string]interface{}{"status": 4031, "message": "下载次数超限"})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 404, "msg": "文件不存在", "data": map[string]interface{}{"download_link": "https://cdn.example.com/stale"}})
+		default:
+			writeJSON(w, map[string]interface{}{"code": 500, "msg": "服务器繁忙"})
+		}
+	}))
+	if _, err := d.Link(context.Background(), &model.Object{ID: "1"}, model.LinkArgs{}); err == nil || !strings.Contains(err.Error(), "文件不存在") {
+		t.Errorf("expect the body error to surface on HTTP 200, got %v", err)
+	}
+	if _, err := d.Link(context.Background(), &model.Object{ID: "2"}, model.LinkArgs{}); err == nil || !strings.Contains(err.Error(), "下载次数超限") {
+		t.Errorf("expect the body error message on a non-200 status, got %v", err)
+	}
+	if _, err := d.Rename(context.Background(), &model.Object{ID: "1"}, "b.txt"); err == nil || !strings.Contains(err.Error(), "服务器繁忙") {
+		t.Errorf("expect rename to report the body error, got %v", err)
+	}
+}
+
+func TestListMaxPages(t *testing.T) {
+	var requests int
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": listItems(requests, requests), "has_more": true}})
+	}))
+	d.MaxPages = 5
+	_, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err == nil || !strings.Contains(err.Error(), "exceeded 5 pages after gathering 5 items") {
+		t.Errorf("expect the page cap to trigger, got %v", err)
+	}
+	if requests != 5 {
+		t.Errorf("expect 5 page requests, got %d", requests)
+	}
+}
+
+func TestFolderQuota(t *testing.T) {
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 3, "name": "team", "type": "folder", "folder_quota": 10, "used_size": 8},
+			}}})
+		case "/czkapi/get_item_info":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+				"id": 3, "name": "team", "type": "folder", "max_size": 10, "used_size": 10, "parent_id": 0,
+			}})
+		default:
+			upload(w, r)
+		}
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	team := objs[0]
+	if _, err := d.Put(context.Background(), team, newTestStream("big.bin", []byte("hello")), func(float64) {}); !errors.Is(err, ErrFolderQuotaExceeded) {
+		t.Errorf("expect ErrFolderQuotaExceeded, got %v", err)
+	}
+	if rec.first != nil {
+		t.Errorf("expect no upload to start for a full folder")
+	}
+	if _, err := d.Put(context.Background(), &model.Object{ID: "3", IsFolder: true}, newTestStream("ok.bin", []byte("hi")), func(float64) {}); err != nil {
+		t.Errorf("expect a file within the remaining quota to upload, got %v", err)
+	}
+	info, err := d.FetchDetails(context.Background(), team)
+	if err != nil {
+		t.Fatalf("failed to fetch details: %+v", err)
+	}
+	if info.FolderQuota != 10 || info.FolderUsed != 10 {
+		t.Errorf("unexpected folder quota: %+v", info)
+	}
+	if _, err := d.Put(context.Background(), &model.Object{ID: "3", IsFolder: true}, newTestStream("ok.bin", []byte("hi")), func(float64) {}); !errors.Is(err, ErrFolderQuotaExceeded) {
+		t.Errorf("expect the refreshed quota to reject the upload, got %v", err)
+	}
+}
+
+func TestTrashAndTrack(t *testing.T) {
+	var form map[string]string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		form = map[string]string{"id": r.FormValue("id"), "type": r.FormValue("type")}
+		if r.FormValue("id") == "6" {
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"trash_id": 9001}})
+	}))
+	trashID, err := d.TrashAndTrack(context.Background(), &model.Object{ID: "5", IsFolder: true})
+	if err != nil {
+		t.Fatalf("failed to trash: %+v", err)
+	}
+	if trashID != "9001" || fmt.Sprint(form) != "map[id:5 type:folder]" {
+		t.Errorf("unexpected trash result %q for form %v", trashID, form)
+	}
+	if _, err := d.TrashAndTrack(context.Background(), &model.Object{ID: "6"}); err == nil {
+		t.Errorf("expect an error when the response has no trash_id")
+	}
+	if err := d.Remove(context.Background(), &model.Object{ID: "6"}); err != nil {
+		t.Errorf("expect Remove not to require a trash_id, got %v", err)
+	}
+}
+
+func TestListPartitioned(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "b.txt", "type": "file"},
+			map[string]interface{}{"id": 2, "name": "docs", "type": "folder"},
+			map[string]interface{}{"id": 3, "name": "a.txt", "type": "file"},
+			map[string]interface{}{"id": 4, "name": "archive", "type": "folder"},
+		}}})
+	}))
+	folders, files, err := d.ListPartitioned(context.Background(), &model.Object{ID: "0", IsFolder: true})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	ids := func(objs []model.Obj) (ids []string) {
+		for _, obj := range objs {
+			ids = append(ids, obj.GetID())
+		}
+		return ids
+	}
+	if fmt.Sprint(ids(folders)) != "[2 4]" || fmt.Sprint(ids(files)) != "[1 3]" {
+		t.Errorf("unexpected partitions: folders %v, files %v", ids(folders), ids(files))
+	}
+}
+
+func TestLinkSoftForbidden(t *testing.T) {
+	newDriver := func(message string) (*CZK, *int) {
+		var refreshes int
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/refresh_token":
+				refreshes++
+				writeJSON(w, map[string]interface{}{
+					"status": 200, "success": true,
+					"data": map[string]interface{}{"access_token": "fresh-token", "expires_in": 3600},
+				})
+			case "/czkapi/get_download_url":
+				if r.Header.Get("Authorization") != "Bearer fresh-token" {
+					w.WriteHeader(http.StatusForbidden)
+					writeJSON(w, map[string]interface{}{"status": 403, "message": message})
+					return
+				}
+				writeJSON(w, map[string]interface{}{"status": 200, "data": map[string]interface{}{"download_link": "https://cdn.example.com/f"}})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		d.RefreshOnLinkForbidden = true
+		return d, &refreshes
+	}
+
+	d, refreshes := newDriver("令牌已过期")
+	link, err := d.Link(context.Background(), &model.Object{ID: "1"}, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("expect the link to succeed after refreshing, got %+v", err)
+	}
+	if link.URL != "https://cdn.example.com/f" || *refreshes != 1 {
+		t.Errorf("expect one refresh and a retried link, got %d refreshes and %q", *refreshes, link.URL)
+	}
+
+	d, refreshes = newDriver("没有访问该文件的权限")
+	if _, err := d.Link(context.Background(), &model.Object{ID: "1"}, model.LinkArgs{}); err == nil {
+		t.Errorf("expect a permission 403 to fail")
+	}
+	if *refreshes != 0 {
+		t.Errorf("expect no refresh for a permission 403, got %d", *refreshes)
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, peak int
+	listed := map[string]int{}
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		folderID := r.URL.Query().Get("folder_id")
+		if folderID == "0" {
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 1, "name": "a", "type": "folder"},
+				map[string]interface{}{"id": 2, "name": "b", "type": "folder"},
+				map[string]interface{}{"id": 3, "name": "c", "type": "folder"},
+			}}})
+			return
+		}
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		listed[folderID]++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": listItems(10, 10)}})
+	}))
+	d.MountPath = "/czk-prewarm-test"
+	d.CacheExpiration = 10
+	d.RootFolderID = "0"
+	d.MaxConcurrentOps = 2
+	d.opSem = make(chan struct{}, d.MaxConcurrentOps)
+	dirs := []model.Obj{
+		&model.Object{ID: "1", Path: "/a", IsFolder: true},
+		&model.Object{ID: "2", Path: "/b", IsFolder: true},
+		&model.Object{ID: "3", Path: "/c", IsFolder: true},
+		&model.Object{ID: "4", IsFolder: true},
+	}
+	if err := d.Prewarm(context.Background(), dirs); err != nil {
+		t.Fatalf("failed to prewarm: %+v", err)
+	}
+	if len(listed) != 4 || peak > 2 {
+		t.Errorf("expect all 4 folders listed with at most 2 in flight, got %v with peak %d", listed, peak)
+	}
+	for _, p := range []string{"/a", "/b", "/c"} {
+		if _, err := op.List(context.Background(), d, p, model.ListArgs{}); err != nil {
+			t.Fatalf("failed to list %s: %+v", p, err)
+		}
+	}
+	if listed["1"] != 1 || listed["2"] != 1 || listed["3"] != 1 {
+		t.Errorf("expect prewarmed folders to be served from cache, got %v", listed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Prewarm(ctx, dirs); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect a canceled context to stop prewarming, got %v", err)
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	defer func(wait, maxWait time.Duration, chunks int) {
+		retryWaitTime, retryMaxWaitTime, chunkMaxRetries = wait, maxWait, chunks
+	}(retryWaitTime, retryMaxWaitTime, chunkMaxRetries)
+	retryWaitTime, retryMaxWaitTime, chunkMaxRetries = time.Millisecond, time.Millisecond, 0
+	attempts := map[string]int{}
+	var folderNames []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts[r.URL.Path]++
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			if attempts[r.URL.Path] <= 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+		case "/czkapi/create_folder":
+			folderNames = append(folderNames, r.FormValue("name"))
+			if attempts[r.URL.Path] == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 9}})
+		case "/czkapi/copy_item":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/czkapi/get_item_info":
+			w.WriteHeader(http.StatusForbidden)
+		case "/upload/key":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			uploadHandler(t, &uploadRecord{})(w, r)
+		}
+	}))
+	d.RetryCount = 3
+	d.configureRetry(d.client)
+	root := &model.Object{ID: "0", IsFolder: true}
+
+	if _, err := d.List(context.Background(), root, model.ListArgs{}); err != nil {
+		t.Fatalf("expect the list to succeed after transient 502s: %+v", err)
+	}
+	if attempts["/czkapi/list_files"] != 3 {
+		t.Errorf("expect 3 list attempts, got %d", attempts["/czkapi/list_files"])
+	}
+	if _, err := d.MakeDir(context.Background(), root, "docs"); err == nil || len(folderNames) != 1 {
+		t.Errorf("expect a create without an idempotency key to fail without retrying, got %v: %v", folderNames, err)
+	}
+	if _, err := d.Copy(context.Background(), &model.Object{ID: "5"}, root); err == nil || attempts["/czkapi/copy_item"] != 1 {
+		t.Errorf("expect copy_item to be sent once after a 502, got %d attempts: %v", attempts["/czkapi/copy_item"], err)
+	}
+	d.IdempotencyKeys = true
+	folderNames = nil
+	attempts["/czkapi/create_folder"] = 0
+	if _, err := d.MakeDir(context.Background(), root, "docs"); err != nil {
+		t.Fatalf("expect the idempotent form post to succeed after a 503: %+v", err)
+	}
+	if len(folderNames) != 2 || folderNames[1] != "docs" {
+		t.Errorf("expect the form body to be replayed, got %v", folderNames)
+	}
+	if _, err := d.getItemInfo(context.Background(), "5", false); err == nil || attempts["/czkapi/get_item_info"] != 1 {
+		t.Errorf("expect a 403 to fail without retrying, got %d attempts: %v", attempts["/czkapi/get_item_info"], err)
+	}
+	if _, err := d.Put(context.Background(), root, newTestStream("a.txt", []byte("hello")), func(float64) {}); err == nil || attempts["/upload/key"] != 1 {
+		t.Errorf("expect a streamed upload body not to be replayed, got %d attempts: %v", attempts["/upload/key"], err)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	failing := true
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+	}))
+	d.UnhealthyAfter = 3
+	root := &model.Object{ID: "0", IsFolder: true}
+	for i := 1; i <= 4; i++ {
+		if _, err := d.List(context.Background(), root, model.ListArgs{}); err == nil {
+			t.Fatalf("expect the list to fail")
+		}
+		if expect := i < 3; d.Healthy() != expect {
+			t.Errorf("after %d failures: expect healthy=%v", i, expect)
+		}
+	}
+	failing = false
+	if _, err := d.List(context.Background(), root, model.ListArgs{}); err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if !d.Healthy() {
+		t.Errorf("expect a success to restore health")
+	}
+	failing = true
+	for i := 0; i < 2; i++ {
+		_, _ = d.List(context.Background(), root, model.ListArgs{})
+	}
+	if !d.Healthy() {
+		t.Errorf("expect the failure count to restart after a success")
+	}
+}
+
+func TestErrorTraceID(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trace-Id", "req-"+r.URL.Query().Get("folder_id"))
+		if r.URL.Query().Get("folder_id") == "1" {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 500, "msg": "busy"})
+	}))
+	for id, expect := range map[string]string{"1": "(trace id: req-1)", "2": "(trace id: req-2)"} {
+		_, err := d.List(context.Background(), &model.Object{ID: id, IsFolder: true}, model.ListArgs{})
+		if err == nil || !strings.Contains(err.Error(), expect) {
+			t.Errorf("folder %s: expect the error to carry %q, got %v", id, expect, err)
+		}
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	var requests int
+	maintenance := true
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if maintenance {
+			w.Header().Set("X-Maintenance", "true")
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+	}))
+	d.MaintenanceCooldown = 30
+	dir := &model.Object{ID: "0", IsFolder: true}
+	if _, err := d.List(context.Background(), dir, model.ListArgs{}); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("expect ErrMaintenance, got %v", err)
+	}
+	maintenance = false
+	if _, err := d.Rename(context.Background(), &model.Object{ID: "1"}, "b.txt"); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("expect requests to be paused during the cooldown, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expect no request to reach the server during the cooldown, got %d", requests)
+	}
+	if until := time.Unix(0, d.maintenanceUntil.Load()); time.Until(until) < 50*time.Second {
+		t.Errorf("expect Retry-After to set the cooldown, got %v", until)
+	}
+	d.maintenanceUntil.Store(0)
+	if _, err := d.List(context.Background(), dir, model.ListArgs{}); err != nil {
+		t.Errorf("expect requests to resume after the cooldown, got %v", err)
+	}
+
+	d = newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		writeJSON(w, map[string]interface{}{"code": maintenanceCode, "msg": "系统维护中"})
+	}))
+	d.MaintenanceCooldown = 0
+	requests = 0
+	for i := 0; i < 2; i++ {
+		if _, err := d.List(context.Background(), dir, model.ListArgs{}); !errors.Is(err, ErrMaintenance) {
+			t.Errorf("expect ErrMaintenance from the maintenance code, got %v", err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expect no cooldown when disabled, got %d requests", requests)
+	}
+}
+
+func TestPutWaitForScan(t *testing.T) {
+	defer func(v time.Duration) { scanPollInterval = v }(scanPollInterval)
+	scanPollInterval = time.Millisecond
+	newDriver := func(final string) (*CZK, *[]string) {
+		rec := &uploadRecord{}
+		upload := uploadHandler(t, rec)
+		var calls []string
+		polls := 0
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/ok_upload":
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"file_id": 42, "scan_status": "scanning"}})
+			case "/czkapi/scan_status":
+				polls++
+				status := "scanning"
+				if polls >= 2 {
+					status = final
+				}
+				calls = append(calls, status)
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"scan_status": status}})
+			case "/czkapi/delete_item":
+				calls = append(calls, "delete "+r.FormValue("id"))
+				writeJSON(w, map[string]interface{}{"code": 200})
+			default:
+				upload(w, r)
+			}
+		}))
+		d.WaitForScan = true
+		return d, &calls
+	}
+	dir := &model.Object{ID: "0", IsFolder: true}
+
+	d, calls := newDriver("clean")
+	obj, err := d.Put(context.Background(), dir, newTestStream("a.txt", []byte("hello")), func(float64) {})
+	if err != nil || obj.GetID() != "42" {
+		t.Fatalf("expect a clean upload to succeed, got %+v, %v", obj, err)
+	}
+	if fmt.Sprint(*calls) != "[scanning clean]" {
+		t.Errorf("expect the scan to be polled until clean, got %v", *calls)
+	}
+
+	d, calls = newDriver("rejected")
+	if _, err := d.Put(context.Background(), dir, newTestStream("a.txt", []byte("hello")), func(float64) {}); !errors.Is(err, ErrScanRejected) {
+		t.Errorf("expect ErrScanRejected, got %v", err)
+	}
+	if fmt.Sprint(*calls) != "[scanning rejected delete 42]" {
+		t.Errorf("expect the rejected file to be deleted, got %v", *calls)
+	}
+}
+
+func TestCapabilityErrors(t *testing.T) {
+	calls := map[string]int{}
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	ctx := context.Background()
+	file := &model.Object{ID: "6"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.FileStats(ctx, file); !errors.Is(err, errs.NotSupport) || errors.Is(err, errs.NotImplement) {
+			t.Errorf("expect NotSupport for a missing endpoint, got %v", err)
+		}
+	}
+	if calls["/czkapi/file_stats"] != 1 {
+		t.Errorf("expect the missing capability to be cached after the first probe, got %d requests", calls["/czkapi/file_stats"])
+	}
+	// 压缩包接口缺失时仍需匹配 NotImplement，OpenList 才会回退到内置解压工具
+	if _, err := d.Extract(ctx, file, model.ArchiveInnerArgs{}); !errors.Is(err, errs.NotSupport) || !errors.Is(err, errs.NotImplement) {
+		t.Errorf("expect NotSupport with NotImplement fallback for extract, got %v", err)
+	}
+	if _, err := d.ArchiveDecompress(ctx, file, &model.Object{ID: "0", IsFolder: true}, model.ArchiveDecompressArgs{}); !errors.Is(err, errs.NotSupport) || !errors.Is(err, errs.NotImplement) {
+		t.Errorf("expect NotSupport with NotImplement fallback for decompress, got %v", err)
+	}
+	if _, err := d.GetDetails(ctx); !errors.Is(err, errs.NotImplement) || errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect plain NotImplement for an unimplemented method, got %v", err)
+	}
+}
+
+func TestFolderDownloadLink(t *testing.T) {
+	supported := true
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/folder_zip" || r.URL.Query().Get("folder_id") != "5" {
+			t.Errorf("unexpected folder zip request: %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		if !supported {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"code": 200,
+			"data": map[string]interface{}{
+				"download_link": "/files/zip/5?sign=abc",
+				"expires_in":    120,
+			},
+		})
+	}))
+	dir := &model.Object{ID: "5", IsFolder: true}
+	link, err := d.FolderDownloadLink(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("failed to get folder zip link: %+v", err)
+	}
+	if link.URL != "https://pan.szczk.top/files/zip/5?sign=abc" {
+		t.Errorf("expect an absolute zip link, got %s", link.URL)
+	}
+	if link.Expiration == nil || *link.Expiration != 2*time.Minute {
+		t.Errorf("expect link expiration of 2m, got %v", link.Expiration)
+	}
+
+	supported = false
+	if _, err := d.FolderDownloadLink(context.Background(), dir); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport, got %v", err)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/czkapi/file_stats" {
+			// 较大的错误响应体，未读完时连接无法复用
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write(bytes.Repeat([]byte("x"), 256*1024))
+			return
+		}
+		upload(w, r)
+	}))
+	var dials int32
+	transport := d.client.GetClient().Transport.(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return dial(ctx, network, addr)
+	}
+	dir := &model.Object{ID: "0", IsFolder: true}
+	for i := 0; i < 3; i++ {
+		if _, err := d.Put(context.Background(), dir, newTestStream("a.txt", []byte("hello")), func(float64) {}); err != nil {
+			t.Fatalf("failed to put: %+v", err)
+		}
+		if _, err := d.FileStats(context.Background(), &model.Object{ID: "6"}); err == nil {
+			t.Fatalf("expect file stats to fail")
+		}
+	}
+	// API主机和上传主机各一个连接
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("expect connections to be reused across requests, got %d dials", n)
+	}
+}
+
+func TestPrefixIDs(t *testing.T) {
+	var sent []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/list_files":
+			sent = append(sent, "list "+r.URL.Query().Get("folder_id"))
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": 5, "name": "a.txt", "type": "file"},
+				map[string]interface{}{"id": 5, "name": "docs", "type": "folder"},
+			}}})
+		case "/czkapi/move_item", "/czkapi/delete_item":
+			sent = append(sent, fmt.Sprintf("%s %s %s %s", path.Base(r.URL.Path), r.FormValue("id"), r.FormValue("type"), r.FormValue("target_id")))
+			writeJSON(w, map[string]interface{}{"code": 200})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.PrefixIDs = true
+	d.RootFolderID = "0"
+	ctx := context.Background()
+	objs, err := d.List(ctx, &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if len(objs) != 2 || objs[0].GetID() != "f:5" || objs[1].GetID() != "d:5" {
+		t.Fatalf("expect type-prefixed IDs, got %v", objs)
+	}
+	if parentID, _ := d.parentOf(objs[0]); parentID != "0" {
+		t.Errorf("expect the root folder ID to stay unprefixed, got %s", parentID)
+	}
+	moved, err := d.Move(ctx, objs[0], objs[1])
+	if err != nil {
+		t.Fatalf("failed to move: %+v", err)
+	}
+	if moved.GetID() != "f:5" {
+		t.Errorf("expect the moved object to keep its prefixed ID, got %s", moved.GetID())
+	}
+	if _, err := d.List(ctx, objs[1], model.ListArgs{}); err != nil {
+		t.Fatalf("failed to list: %+v", err)
+	}
+	if err := d.Remove(ctx, objs[1]); err != nil {
+		t.Fatalf("failed to remove: %+v", err)
+	}
+	expect := []string{"list 0", "move_item 5 file 5", "list 5", "delete_item 5 folder "}
+	if fmt.Sprint(sent) != fmt.Sprint(expect) {
+		t.Errorf("expect prefixes to be stripped in requests, got %q", sent)
+	}
+}
+
+func TestUploadRateLimit(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	d.UploadRateLimitKBps = 64
+	d.uploadLimiter = newRateLimiter(d.UploadRateLimitKBps)
+	content := bytes.Repeat([]byte("x"), 48*1024)
+	var progress float64
+	start := time.Now()
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.bin", content), func(p float64) { progress = p }); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	elapsed := time.Since(start)
+	if !bytes.Equal(rec.body, content) {
+		t.Fatalf("expect the full content to be uploaded, got %d bytes", len(rec.body))
+	}
+	// 初始突发量之外的内容按 64KB/s 发送
+	burst := d.uploadLimiter.Burst()
+	expect := time.Duration(float64(len(content)-burst) / float64(64*1024) * float64(time.Second))
+	if elapsed < expect*9/10 || elapsed > expect*3 {
+		t.Errorf("expect the upload to take about %v at the configured cap, took %v", expect, elapsed)
+	}
+	if progress != 100 {
+		t.Errorf("expect progress to reach 100, got %v", progress)
+	}
+}
+
+func TestInMemoryUpload(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	d.InMemoryUploadMaxBytes = 1024
+	oldConf := conf.Conf
+	conf.Conf = &conf.Config{TempDir: t.TempDir()}
+	defer func() { conf.Conf = oldConf }()
+	for _, tt := range []struct {
+		size     int
+		inMemory bool
+	}{{1024, true}, {1025, false}} {
+		content := bytes.Repeat([]byte("x"), tt.size)
+		file := newTestStream("a.bin", content)
+		// 关闭内存缓冲，使 CacheFullAndHash 总是落盘到临时文件
+		conf.MaxBufferLimit = 0
+		if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, file, func(float64) {}); err != nil {
+			t.Fatalf("failed to put %d bytes: %+v", tt.size, err)
+		}
+		if !bytes.Equal(rec.body, content) {
+			t.Errorf("expect the full content to be uploaded, got %d bytes", len(rec.body))
+		}
+		if md5 := utils.HashData(utils.MD5, content); rec.first["hash"] != md5 {
+			t.Errorf("expect hash %s, got %s", md5, rec.first["hash"])
+		}
+		_, tempFile := file.GetFile().(*os.File)
+		if tempFile == tt.inMemory {
+			t.Errorf("%d bytes: expect in-memory=%v, got a temp file=%v", tt.size, tt.inMemory, tempFile)
+		}
+		_ = file.Close()
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	var requests []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Host+r.URL.Path)
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{}}})
+	}))
+	for _, base := range []string{"https://mirror.example.com/pan/czkapi", "https://mirror.example.com/pan/czkapi/"} {
+		requests = nil
+		d.BaseURL = base
+		if _, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{}); err != nil {
+			t.Fatalf("failed to list: %+v", err)
+		}
+		if len(requests) != 1 || requests[0] != "mirror.example.com/pan/czkapi/list_files" {
+			t.Errorf("base %s: expect requests to the mirror, got %v", base, requests)
+		}
+	}
+	if link, _ := d.absoluteURL("/s/abc"); link != "https://mirror.example.com/s/abc" {
+		t.Errorf("expect relative links to resolve against the mirror, got %s", link)
+	}
+	if d.downloadHeader("https://mirror.example.com/files/1").Get("Authorization") == "" {
+		t.Errorf("expect the token to be sent to the mirror host")
+	}
+	if err := (&CZK{Addition: Addition{BaseURL: "pan.szczk.top/czkapi"}}).Init(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid base url") {
+		t.Errorf("expect an error for a base url without scheme, got %v", err)
+	}
+}
+
+func TestLinkAuthorizationHost(t *testing.T) {
+	var cdnAuth []string
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			link := "https://cdn.example.com/f/1"
+			if r.URL.Query().Get("file_id") == "2" {
+				link = "/files/download/2?sign=abc"
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": link}})
+		case "/f/1":
+			cdnAuth = append(cdnAuth, r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte("data"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.AccessToken = "secret-token"
+	d.DownloadRateLimitKBps = 1024
+	d.downloadLimiter = newRateLimiter(d.DownloadRateLimitKBps)
+	link, err := d.Link(context.Background(), &model.Object{ID: "1", Size: 4}, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	if auth := link.Header.Get("Authorization"); auth != "" {
+		t.Errorf("expect no Authorization header for a CDN link, got %q", auth)
+	}
+	rc, err := link.RangeReader.RangeRead(context.Background(), http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatalf("failed to read link: %+v", err)
+	}
+	_, _ = io.ReadAll(rc)
+	rc.Close()
+	if len(cdnAuth) != 1 || cdnAuth[0] != "" {
+		t.Errorf("expect the CDN request to carry no token, got %q", cdnAuth)
+	}
+
+	link, err = d.Link(context.Background(), &model.Object{ID: "2"}, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	if auth := link.Header.Get("Authorization"); auth != "Bearer secret-token" {
+		t.Errorf("expect the token for an API-host link, got %q", auth)
+	}
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*1024)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "/files/1"}})
+		case "/files/1":
+			http.ServeContent(w, r, "a.bin", time.Time{}, bytes.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	d.DownloadRateLimitKBps = 64
+	d.downloadLimiter = newRateLimiter(d.DownloadRateLimitKBps)
+	link, err := d.Link(context.Background(), &model.Object{ID: "1", Size: int64(len(content))}, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("failed to get link: %+v", err)
+	}
+	if link.RangeReader == nil || link.URL == "" {
+		t.Fatalf("expect a throttled range reader alongside the redirect URL")
+	}
+	start := time.Now()
+	rc, err := link.RangeReader.RangeRead(context.Background(), http_range.Range{Start: 0, Length: -1})
+	if err != nil {
+		t.Fatalf("failed to read range: %+v", err)
+	}
+	got, err := io.ReadAll(rc)
+	_ = rc.Close()
+	elapsed := time.Since(start)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("expect the full content, got %d bytes, %v", len(got), err)
+	}
+	burst := d.downloadLimiter.Burst()
+	expect := time.Duration(float64(len(content)-burst) / float64(64*1024) * float64(time.Second))
+	if elapsed < expect*9/10 || elapsed > expect*3 {
+		t.Errorf("expect the download to take about %v at the configured cap, took %v", expect, elapsed)
+	}
+
+	rc, err = link.RangeReader.RangeRead(context.Background(), http_range.Range{Start: 100, Length: 16})
+	if err != nil {
+		t.Fatalf("failed to read range: %+v", err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); !bytes.Equal(got, content[100:116]) {
+		t.Errorf("expect the requested range, got %q", got)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/get_download_url":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"download_link": "/files/" + r.URL.Query().Get("file_id")}})
+		case "/files/1":
+			http.ServeContent(w, r, "a.bin", time.Time{}, bytes.NewReader(content))
+		case "/files/2":
+			// 忽略Range的下载主机
+			_, _ = w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	file := &model.Object{ID: "1", Name: "a.bin", Size: int64(len(content))}
+	var buf bytes.Buffer
+	n, err := d.ReadRange(context.Background(), file, 100, 37, &buf)
+	if err != nil {
+		t.Fatalf("failed to read range: %+v", err)
+	}
+	if n != 37 || !bytes.Equal(buf.Bytes(), content[100:137]) {
+		t.Errorf("expect exactly bytes 100-136, got %d bytes %q", n, buf.Bytes())
+	}
+
+	buf.Reset()
+	if n, err = d.ReadRange(context.Background(), file, int64(len(content))-4, 16, &buf); err != nil || n != 4 || !bytes.Equal(buf.Bytes(), content[len(content)-4:]) {
+		t.Errorf("expect a range past the end to stop at the end, got %d bytes, %v", n, err)
+	}
+
+	if _, err = d.ReadRange(context.Background(), &model.Object{ID: "2", Name: "b.bin"}, 100, 37, io.Discard); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("expect ErrRangeNotSupported when the host ignores Range, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = d.ReadRange(ctx, file, 0, 16, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect a cancelled context to abort the read, got %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	requests := 0
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/czkapi/features":
+			requests++
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+				"copy":             true,
+				"search":           true,
+				"offline_download": false,
+				"archive":          false,
+				"share":            true,
+			}})
+		default:
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		caps, err := d.Capabilities(ctx)
+		if err != nil {
+			t.Fatalf("failed to get capabilities: %+v", err)
+		}
+		expect := Capabilities{Copy: true, Search: true, Share: true}
+		if caps != expect {
+			t.Errorf("expect %+v, got %+v", expect, caps)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expect capabilities to be cached, got %d requests", requests)
+	}
+	// 声明不支持的功能不再请求对应接口
+	if _, err := d.Extract(ctx, &model.Object{ID: "7"}, model.ArchiveInnerArgs{}); !errors.Is(err, errs.NotSupport) {
+		t.Errorf("expect NotSupport for an archive operation, got %v", err)
+	}
+}
+
+func TestUploadProgressInterval(t *testing.T) {
+	rec := &uploadRecord{}
+	d := newTestDriver(t, uploadHandler(t, rec))
+	d.ProgressInterval = 250
+	var updates []float64
+	content := bytes.Repeat([]byte("x"), 1<<20)
+	if _, err := d.Put(context.Background(), &model.Object{ID: "0", IsFolder: true}, newTestStream("a.bin", content), func(p float64) { updates = append(updates, p) }); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if len(rec.body) != len(content) {
+		t.Fatalf("expect the full content to be uploaded, got %d bytes", len(rec.body))
+	}
+	// 本地上传远快于间隔，只应回调首次进度和最终的100%
+	if len(updates) > 3 || updates[len(updates)-1] != 100 {
+		t.Errorf("expect few progress updates ending at 100, got %v", updates)
+	}
+}
+
+func TestMergeFolders(t *testing.T) {
+	tree := map[string][]interface{}{
+		"1": {
+			map[string]interface{}{"id": 11, "name": "a.txt", "type": "file"},
+			map[string]interface{}{"id": 12, "name": "b.txt", "type": "file"},
+			map[string]interface{}{"id": 13, "name": "sub", "type": "folder"},
+		},
+		"2": {
+			map[string]interface{}{"id": 21, "name": "a.txt", "type": "file"},
+			map[string]interface{}{"id": 23, "name": "sub", "type": "folder"},
+		},
+		"13": {map[string]interface{}{"id": 31, "name": "c.txt", "type": "file"}},
+		"23": {},
+	}
+	newDriver := func(policy string) (*CZK, *[]string) {
+		var ops []string
+		d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/czkapi/list_files":
+				writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": tree[r.URL.Query().Get("folder_id")]}})
+			case "/czkapi/batch_move":
+				http.NotFound(w, r)
+			case "/czkapi/rename_item":
+				ops = append(ops, fmt.Sprintf("rename %s %s", r.FormValue("id"), r.FormValue("new_name")))
+				writeJSON(w, map[string]interface{}{"code": 200})
+			case "/czkapi/move_item":
+				ops = append(ops, fmt.Sprintf("move %s %s", r.FormValue("id"), r.FormValue("target_id")))
+				writeJSON(w, map[string]interface{}{"code": 200})
+			case "/czkapi/delete_item":
+				ops = append(ops, "delete "+r.FormValue("id"))
+				writeJSON(w, map[string]interface{}{"code": 200})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		d.OverwritePolicy = policy
+		d.RemoveMergedFolder = true
+		return d, &ops
+	}
+	src := &model.Object{ID: "1", IsFolder: true}
+	dst := &model.Object{ID: "2", IsFolder: true}
+
+	d, ops := newDriver("rename")
+	if err := d.MergeFolders(context.Background(), src, dst); err != nil {
+		t.Fatalf("failed to merge: %+v", err)
+	}
+	expect := []string{"rename 11 a (1).txt", "move 31 23", "delete 13", "move 11 2", "move 12 2", "delete 1"}
+	if fmt.Sprint(*ops) != fmt.Sprint(expect) {
+		t.Errorf("expect %q, got %q", expect, *ops)
+	}
+
+	d, ops = newDriver("skip")
+	if err := d.MergeFolders(context.Background(), src, dst); err != nil {
+		t.Fatalf("failed to merge: %+v", err)
+	}
+	expect = []string{"move 31 23", "delete 13", "move 12 2"}
+	if fmt.Sprint(*ops) != fmt.Sprint(expect) {
+		t.Errorf("expect the colliding file to stay and the source to be kept, got %q", *ops)
+	}
+
+	d, ops = newDriver("overwrite")
+	if err := d.MergeFolders(context.Background(), src, dst); err != nil {
+		t.Fatalf("failed to merge: %+v", err)
+	}
+	expect = []string{"delete 21", "move 31 23", "delete 13", "move 11 2", "move 12 2", "delete 1"}
+	if fmt.Sprint(*ops) != fmt.Sprint(expect) {
+		t.Errorf("expect the existing file to be replaced, got %q", *ops)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.MergeFolders(ctx, src, dst); !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "after moving 0 items") {
+		t.Errorf("expect a cancelled merge to report its progress, got %v", err)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	defer func(v time.Duration) { completeRetryBaseDelay = v }(completeRetryBaseDelay)
+	completeRetryBaseDelay = time.Millisecond
+	keys := map[string][]string{}
+	mkdirCalls, completeCalls := 0, 0
+	rec := &uploadRecord{}
+	upload := uploadHandler(t, rec)
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys[r.URL.Path] = append(keys[r.URL.Path], r.Header.Get("Idempotency-Key"))
+		switch r.URL.Path {
+		case "/czkapi/create_folder":
+			// 首次响应在传输中断开，重试时应携带相同的幂等键
+			if mkdirCalls++; mkdirCalls == 1 {
+				_, _ = w.Write([]byte(`{"code":200,"data":{"fold`))
+				return
+			}
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"folder_id": 9}})
+		case "/czkapi/ok_upload":
+			if completeCalls++; completeCalls == 1 {
+				w.WriteHeader(http.StatusAccepted)
+				writeJSON(w, map[string]interface{}{"code": 202})
+				return
+			}
+			upload(w, r)
+		default:
+			upload(w, r)
+		}
+	}))
+	d.IdempotencyKeys = true
+	ctx := context.Background()
+	if _, err := d.MakeDir(ctx, &model.Object{ID: "0", IsFolder: true}, "docs"); err != nil {
+		t.Fatalf("failed to make dir: %+v", err)
+	}
+	if _, err := d.Put(ctx, &model.Object{ID: "0", IsFolder: true}, newTestStream("a.txt", []byte("hello")), func(float64) {}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	mkdir, complete := keys["/czkapi/create_folder"], keys["/czkapi/ok_upload"]
+	if len(mkdir) != 2 || mkdir[0] == "" || mkdir[0] != mkdir[1] {
+		t.Errorf("expect retries of MakeDir to share one key, got %q", mkdir)
+	}
+	if len(complete) != 2 || complete[0] == "" || complete[0] != complete[1] || complete[0] == mkdir[0] {
+		t.Errorf("expect retries of the upload completion to share their own key, got %q", complete)
+	}
+	if first := keys["/czkapi/first_upload"]; first[0] != "" {
+		t.Errorf("expect no key on requests that are safe to repeat, got %q", first)
+	}
+}
+
+func TestListChildPresence(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "counted", "type": "folder", "child_count": 3},
+			map[string]interface{}{"id": 2, "name": "empty", "type": "folder", "has_children": false},
+			map[string]interface{}{"id": 3, "name": "unknown", "type": "folder"},
+		}}})
+	}))
+	objs, err := d.List(context.Background(), &model.Object{ID: "0", IsFolder: true}, model.ListArgs{})
+	if err != nil || len(objs) != 3 {
+		t.Fatalf("failed to list: %v, %+v", objs, err)
+	}
+	counted, empty, unknown := objs[0].(*Object), objs[1].(*Object), objs[2].(*Object)
+	if counted.HasChildren == nil || !*counted.HasChildren || counted.ChildCount != 3 {
+		t.Errorf("expect a folder with 3 children, got %v, %d", counted.HasChildren, counted.ChildCount)
+	}
+	if empty.HasChildren == nil || *empty.HasChildren {
+		t.Errorf("expect an empty folder, got %v", empty.HasChildren)
+	}
+	if unknown.HasChildren != nil {
+		t.Errorf("expect child presence to be unknown, got %v", *unknown.HasChildren)
+	}
+}
+
+func TestFileDestination(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+	}))
+	ctx := context.Background()
+	file := &model.Object{ID: "5", Name: "a.txt"}
+	src := &model.Object{ID: "6", Name: "b.txt"}
+	if _, err := d.Put(ctx, file, newTestStream("c.txt", []byte("hello")), func(float64) {}); !errors.Is(err, errs.NotFolder) {
+		t.Errorf("Put: expect NotFolder, got %v", err)
+	}
+	if _, err := d.MakeDir(ctx, file, "docs"); !errors.Is(err, errs.NotFolder) {
+		t.Errorf("MakeDir: expect NotFolder, got %v", err)
+	}
+	if _, err := d.Move(ctx, src, file); !errors.Is(err, errs.NotFolder) {
+		t.Errorf("Move: expect NotFolder, got %v", err)
+	}
+	if _, err := d.CopyChildren(ctx, &model.Object{ID: "0", IsFolder: true}, []string{"6"}, file); !errors.Is(err, errs.NotFolder) {
+		t.Errorf("CopyChildren: expect NotFolder, got %v", err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	d := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/czkapi/changes" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{
+				"events": []interface{}{
+					map[string]interface{}{"type": "create", "id": 7, "item_type": "file", "name": "a.txt", "parent_id": 3, "time": "2025-06-29 15:37:01"},
+					map[string]interface{}{"type": "move", "id": 4, "item_type": "folder", "name": "docs", "parent_id": 5, "old_parent_id": 3},
+				},
+				"next_cursor": "c1",
+			}})
+		case "c1":
+			writeJSON(w, map[string]interface{}{"code": 200, "data": map[string]interface{}{"events": []interface{}{}}})
+		default:
+			t.Errorf("unexpected cursor: %s", r.URL.RawQuery)
+		}
+	}))
+	ctx := context.Background()
+	events, cursor, err := d.Changes(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to get changes: %+v", err)
+	}
+	if cursor != "c1" || len(events) != 2 {
+		t.Fatalf("expect 2 events and cursor c1, got %+v, %s", events, cursor)
+	}
+	created, moved := events[0], events[1]
+	if created.Type != ChangeCreate || created.ID != "7" || created.IsFolder || created.ParentID != "3" || created.Time.IsZero() {
+		t.Errorf("unexpected create event: %+v", created)
+	}
+	if moved.Type != ChangeMove || !moved.IsFolder || moved.ParentID != "5" || moved.OldParentID != "3" {
+		t.Errorf("unexpected move event: %+v", moved)
+	}
+	events, cursor, err = d.Changes(ctx, cursor)
+	if err != nil || len(events) != 0 || cursor != "c1" {
+		t.Errorf("expect no new events and the cursor to stay, got %+v, %s, %v", events, cursor, err)
+	}
+}
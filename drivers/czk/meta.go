@@ -1,28 +1,112 @@
-package czk
-
-import (
-	"github.com/OpenListTeam/OpenList/v4/internal/driver"
-	"github.com/OpenListTeam/OpenList/v4/internal/op"
-)
-
-type Addition struct {
-	driver.RootID
-	APIKey    string `json:"api_key" required:"true"`
-	APISecret string `json:"api_secret" required:"true"`
-}
-
-var config = driver.Config{
-	Name:        "星辰云盘",
-	LocalSort:   false,
-	OnlyProxy:   false,
-	NoCache:     false,
-	NoUpload:    false, // 启用上传功能
-	NeedMs:      false,
-	DefaultRoot: "0",
-}
-
-func init() {
-	op.RegisterDriver(func() driver.Driver {
-		return &CZK{}
-	})
-}
\ No newline at end of file
+package czk
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+)
+
+type Addition struct {
+	driver.RootID
+	APIKey    string `json:"api_key" required:"true"`
+	APISecret string `json:"api_secret" required:"true"`
+	// 自建或镜像实例的API地址，末尾的斜杠可有可无
+	BaseURL string `json:"base_url" default:"https://pan.szczk.top/czkapi" help:"API base URL, change for self-hosted or mirrored instances"`
+	// 列表中缺少名称的条目：跳过或使用根据ID生成的占位名称
+	NamelessItem string `json:"nameless_item" type:"select" options:"skip,placeholder" default:"skip" help:"how to handle listed items without a name"`
+	// 管理员恢复场景：在列表中显示回收站中的条目
+	IncludeTrashed bool `json:"include_trashed" type:"bool" default:"false" help:"show trashed items in listings, prefixed with [trashed]"`
+	// 双栈网络下IPv6路由异常时优先使用IPv4连接
+	PreferIPv4 bool `json:"prefer_ipv4" type:"bool" default:"false" help:"prefer IPv4 when connecting to the API and download hosts"`
+	// 部分网关在HTTP/2下会卡住，开启后只使用HTTP/1.1
+	ForceHTTP1 bool `json:"force_http1" type:"bool" default:"false" help:"disable HTTP/2 and always use HTTP/1.1"`
+	// 自建镜像使用私有CA时信任的CA证书（文件路径或PEM内容），比关闭证书校验更安全
+	CACertPEM string `json:"ca_cert_pem" type:"text" help:"path to, or inline PEM of, an extra CA certificate to trust for private mirrors"`
+	// 后端的文件和文件夹可能共用数字ID，开启后对象ID带有类型前缀（f:5 / d:5），请求后端时去掉
+	PrefixIDs bool `json:"prefix_ids" type:"bool" default:"false" help:"prefix object IDs with their type (f:/d:) so files and folders sharing a numeric ID never collide"`
+	// 小于该大小（字节）的文件上传时直接在内存中缓存并计算MD5，不创建临时文件，0 表示总是使用临时文件
+	InMemoryUploadMaxBytes int64 `json:"in_memory_upload_max_bytes" type:"number" default:"4194304" help:"files up to this size in bytes are buffered in memory instead of a temp file before upload, 0 to always use a temp file"`
+	// 上传限速（KB/s），共享网络下避免占满带宽，0 表示不限速
+	UploadRateLimitKBps int `json:"upload_rate_limit_kbps" type:"number" default:"0" help:"cap upload bandwidth in KB/s, 0 means unlimited"`
+	// 上传进度回调的最小间隔（毫秒），避免频繁刷新界面，0 表示每次读取都回调
+	ProgressInterval int `json:"progress_interval" type:"number" default:"250" help:"minimum milliseconds between upload progress updates, 0 to report every read"`
+	// 下载限速（KB/s），仅对经由本机代理的下载生效，0 表示不限速
+	DownloadRateLimitKBps int `json:"download_rate_limit_kbps" type:"number" default:"0" help:"cap proxied download bandwidth in KB/s, 0 means unlimited"`
+	// 同时进行的上传数上限，后端对上传单独限流时避免并发上传触发限制，读取操作不受影响，0 表示不限制
+	MaxConcurrentUploads int `json:"max_concurrent_uploads" type:"number" default:"2" help:"max uploads running at the same time, separate from max_concurrent_ops, 0 means unlimited"`
+	// 同一账号同时进行的操作数上限，避免批量操作压垮后端
+	MaxConcurrentOps int `json:"max_concurrent_ops" type:"number" default:"0" help:"max operations running at the same time, 0 means unlimited"`
+	// 连续刷新令牌达到该次数后重新进行完整认证，避免刷新令牌过旧
+	ReauthAfterRefreshes int `json:"reauth_after_refreshes" type:"number" default:"24" help:"re-authenticate after this many token refreshes, 0 means never"`
+	// 对较大的表单请求体使用gzip压缩，需要后端支持 Content-Encoding: gzip
+	GzipRequestBody bool `json:"gzip_request_body" type:"bool" default:"false" help:"gzip large form request bodies if the server accepts it"`
+	// 使用 APISecret 对表单请求进行HMAC签名，后端要求签名时开启
+	SignRequests bool `json:"sign_requests" type:"bool" default:"false" help:"sign form requests with HMAC-SHA256 using the API secret"`
+	// 创建文件夹、完成上传和复制时发送 Idempotency-Key 头，后端支持时避免重试造成重复
+	IdempotencyKeys bool `json:"idempotency_keys" type:"bool" default:"false" help:"send an Idempotency-Key header on create, upload completion and copy so retries are not applied twice"`
+	// 上传完成后重新列出目标文件夹，以返回带有服务端ID和时间的完整对象
+	RelistAfterPut bool `json:"relist_after_put" type:"bool" default:"false" help:"re-list the target folder after upload to return the server's full object"`
+	// 创建文件夹时同名文件夹已存在（如并发创建），返回已存在的文件夹而不是报错
+	ReuseExistingFolder bool `json:"reuse_existing_folder" type:"bool" default:"true" help:"return the existing folder when MakeDir races with another creator of the same name"`
+	// 按路径上传时自动创建缺失的中间文件夹
+	CreateParentFolders bool `json:"create_parent_folders" type:"bool" default:"false" help:"create missing intermediate folders when uploading to a path"`
+	// 将名称规范化为Unicode NFC形式，macOS客户端产生的NFD名称与后端的NFC名称不再被视为不同
+	NormalizeNames bool `json:"normalize_names" type:"bool" default:"false" help:"normalize names to Unicode NFC when creating, renaming, uploading and listing"`
+	// 合并文件夹时与目标文件夹中条目同名的处理方式：跳过、重命名后移动或覆盖
+	OverwritePolicy string `json:"overwrite_policy" type:"select" options:"rename,skip,overwrite" default:"rename" help:"how merging folders handles a name that already exists in the destination"`
+	// 合并文件夹后删除已为空的源文件夹
+	RemoveMergedFolder bool `json:"remove_merged_folder" type:"bool" default:"true" help:"delete the source folder once a merge has emptied it"`
+	// 页码分页时每页请求的条目数
+	PageSize int `json:"page_size" type:"number" default:"200" help:"items requested per page when listing large folders"`
+	// 单次列表最多请求的页数，防止后端分页信息错误导致无限循环
+	MaxPages int `json:"max_pages" type:"number" default:"1000" help:"max pages requested by a single listing before giving up"`
+	// 合并短时间内连续重复的警告和错误日志，输出重复次数汇总
+	DedupLogs bool `json:"dedup_logs" type:"bool" default:"false" help:"collapse identical consecutive warning and error log lines into a repeat summary"`
+	// 获取下载链接返回表示令牌过期的403时，刷新令牌后重试一次
+	RefreshOnLinkForbidden bool `json:"refresh_on_link_forbidden" type:"bool" default:"true" help:"refresh the token and retry once when the download link request is rejected with an expired-token 403"`
+	// 后端进入维护模式后暂停所有请求的时间（秒），0 表示不暂停
+	MaintenanceCooldown int `json:"maintenance_cooldown" type:"number" default:"60" help:"seconds to pause all requests after the server reports maintenance, 0 to disable"`
+	// 上传完成后等待后端病毒扫描结束再返回
+	WaitForScan bool `json:"wait_for_scan" type:"bool" default:"false" help:"wait for the server-side virus scan to finish before an upload returns"`
+	// 等待病毒扫描的最长时间（秒）
+	ScanTimeout int `json:"scan_timeout" type:"number" default:"120" help:"max seconds to wait for the virus scan"`
+	// Glob 递归查找的最大目录深度
+	GlobMaxDepth int `json:"glob_max_depth" type:"number" default:"10" help:"max folder depth walked by glob matching"`
+	// 连续失败多少次请求后将存储标记为不健康，0 表示不标记
+	UnhealthyAfter int `json:"unhealthy_after" type:"number" default:"5" help:"consecutive failed requests (network errors or 5xx) before the storage is reported unhealthy, 0 to disable"`
+	// 网络错误和5xx响应的自动重试次数，0 表示不重试
+	RetryCount int `json:"retry_count" type:"number" default:"3" help:"times to retry a request after a network error or 5xx response, 0 to disable"`
+	// 驱动内按ID缓存的对象数量上限，超出后淘汰最久未使用的对象，0 表示不限制
+	MaxCachedItems int `json:"max_cached_items" type:"number" default:"10000" help:"max objects kept in the internal ID cache before evicting the least recently used, 0 for unlimited"`
+	// 大文件上传时每个分片的大小（MB），0 表示在一个请求中发送整个文件
+	UploadChunkSize int `json:"upload_chunk_size" type:"number" default:"20" help:"size in MB of each part sent when uploading large files, 0 to send the whole file in one request"`
+	// 将晚于当前时间的修改时间截断为当前时间，默认保留后端返回的原始时间
+	ClampFutureTimes bool `json:"clamp_future_times" type:"bool" default:"false" help:"cap modified times that lie in the future at the current time"`
+	// 列表和扩展名都无法确定内容类型时，对下载链接发送HEAD请求读取 Content-Type，便于预览无扩展名的文件
+	DetectMimeViaHead bool `json:"detect_mime_via_head" type:"bool" default:"false" help:"read the content type of files with no known extension from a HEAD on their download link"`
+	// 返回下载链接前异步发送HEAD请求预热CDN节点，减少视频起播缓冲
+	WarmDownloadLink bool `json:"warm_download_link" type:"bool" default:"false" help:"send a background HEAD to download links to warm up the CDN"`
+	// 在后台于令牌过期前主动刷新，避免长时间空闲后重新认证
+	KeepTokenWarm bool `json:"keep_token_warm" type:"bool" default:"false" help:"refresh the access token in the background shortly before it expires"`
+	// 持久化的令牌（不在设置页面显示），重启后仍在有效期内时直接复用，避免每次启动都重新认证
+	// SavedTokenKey 为签发令牌时使用的 APIKey，修改 APIKey 后不再复用旧令牌
+	SavedAccessToken  string `json:"saved_access_token" ignore:"true"`
+	SavedRefreshToken string `json:"saved_refresh_token" ignore:"true"`
+	SavedTokenExpiry  int64  `json:"saved_token_expiry" ignore:"true"`
+	SavedTokenKey     string `json:"saved_token_key" ignore:"true"`
+}
+
+var config = driver.Config{
+	Name:        "星辰云盘",
+	LocalSort:   false,
+	OnlyProxy:   false,
+	NoCache:     false,
+	NoUpload:    false, // 启用上传功能
+	NeedMs:      false,
+	DefaultRoot: "0",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &CZK{}
+	})
+}
@@ -1,44 +1,363 @@
-package czk
-
-// AuthResp 认证响应结构
-type AuthResp struct {
-	Data struct {
-		AccessToken  string `json:"access_token"`
-		ExpiresIn    int64  `json:"expires_in"`
-		RefreshToken string `json:"refresh_token"`
-		TokenType    string `json:"token_type"`
-	} `json:"data"`
-	Message string `json:"message"`
-	Status  int64  `json:"status"`
-}
-
-// RefreshResp 刷新令牌响应结构
-type RefreshResp struct {
-	Data struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int64  `json:"expires_in"`
-		TokenType   string `json:"token_type"`
-		// 刷新令牌时可能返回新的刷新令牌
-		RefreshToken string `json:"refresh_token,omitempty"`
-	} `json:"data"`
-	FileID  string `json:"file_id,omitempty"`
-	Message string `json:"message"`
-	Status  int64  `json:"status"`
-	Success bool   `json:"success,omitempty"`
-}
-
-// OperationResp 通用操作响应结构（用于重命名、删除、移动等操作）
-type OperationResp struct {
-	Status  int                    `json:"status"`
-	Message string                 `json:"message"`
-	Data    map[string]interface{} `json:"data,omitempty"`
-}
-
-// File 文件信息结构
-type File struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Size     int64  `json:"size"`
-	Modified string `json:"modified"`
-	IsFolder bool   `json:"is_folder"`
-}
\ No newline at end of file
+package czk
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+// AuthResp 认证响应结构
+type AuthResp struct {
+	Data struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+	} `json:"data"`
+	Message string `json:"message"`
+	Status  int64  `json:"status"`
+}
+
+// RefreshResp 刷新令牌响应结构
+// 刷新接口只返回令牌信息，file_id 仅出现在上传完成(ok_upload)的响应中，这里不再解析
+type RefreshResp struct {
+	Data struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+		// 刷新令牌时可能返回新的刷新令牌
+		RefreshToken string `json:"refresh_token,omitempty"`
+	} `json:"data"`
+	Message string `json:"message"`
+	Status  int64  `json:"status"`
+	Success bool   `json:"success,omitempty"`
+}
+
+// OperationResp 通用操作响应结构（用于重命名、删除、移动等操作）
+type OperationResp struct {
+	Status  int                    `json:"status"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Envelope 响应体中的业务状态，不同接口分别使用 code 或 status 表示结果，msg 或 message 表示错误信息
+type Envelope struct {
+	Code    int64  `json:"code"`
+	Status  int64  `json:"status"`
+	Msg     string `json:"msg"`
+	Message string `json:"message"`
+}
+
+// ListResp 文件列表响应结构，后端可能使用游标(next_cursor)、has_more标记或页码(total_count)分页
+type ListResp struct {
+	Envelope
+	Data struct {
+		Items      []Item      `json:"items"`
+		TotalCount json.Number `json:"total_count"`
+		HasMore    *bool       `json:"has_more"`
+		NextCursor *string     `json:"next_cursor"`
+	} `json:"data"`
+}
+
+// RecentFilesResp 最近文件响应结构
+type RecentFilesResp struct {
+	Envelope
+	Data struct {
+		Items []Item `json:"items"`
+	} `json:"data"`
+}
+
+// ItemInfoResp 单个文件或文件夹详情响应结构
+type ItemInfoResp struct {
+	Envelope
+	Data *Item `json:"data"`
+}
+
+// Item 列表、详情等接口返回的文件或文件夹条目
+// 数字字段使用 json.Number，后端以数字或字符串返回时都能解析
+type Item struct {
+	ID         json.Number `json:"id"`
+	Name       string      `json:"name"`
+	Size       json.Number `json:"size"`
+	Type       string      `json:"type"`
+	CreatedAt  string      `json:"created_at"`
+	UploadedAt string      `json:"uploaded_at"`
+	Trashed    bool        `json:"trashed"`
+	// 内容哈希，hash 与上传接口一致为MD5
+	MD5      string `json:"md5"`
+	Hash     string `json:"hash"`
+	SHA1     string `json:"sha1"`
+	SHA256   string `json:"sha256"`
+	ETag     string `json:"etag"`
+	Note     string `json:"note"`
+	MimeType string `json:"mime_type"`
+	// 文档的在线预览地址，以及文档是否设置了打开密码
+	PreviewURL        string `json:"preview_url"`
+	PasswordProtected bool   `json:"password_protected"`
+	// 文件夹的容量上限，部分后端使用 max_size
+	FolderQuota json.Number `json:"folder_quota"`
+	MaxSize     json.Number `json:"max_size"`
+	UsedSize    json.Number `json:"used_size"`
+	ChildCount  json.Number `json:"child_count"`
+	HasChildren *bool       `json:"has_children"`
+	// ParentID 和 Path 仅在最近文件、详情等跨文件夹的接口中返回
+	ParentID json.Number `json:"parent_id"`
+	Path     string      `json:"path"`
+}
+
+// DecompressResp 服务端解压响应结构，items 为解压后在目标文件夹中生成的条目
+type DecompressResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Items []Item `json:"items"`
+	} `json:"data"`
+}
+
+// ArchivePeekResp 压缩包预览响应结构
+type ArchivePeekResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Comment   string         `json:"comment"`
+		Encrypted bool           `json:"encrypted"`
+		Entries   []ArchiveEntry `json:"entries"`
+	} `json:"data"`
+}
+
+// ArchiveEntry 压缩包内的文件或文件夹，文件夹的子条目在 Children 中
+type ArchiveEntry struct {
+	Name     string         `json:"name"`
+	Size     int64          `json:"size"`
+	Type     string         `json:"type"`
+	Modified string         `json:"modified"`
+	Children []ArchiveEntry `json:"children"`
+}
+
+// ExtractResp 压缩包内单个文件的下载链接响应结构
+type ExtractResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		DownloadLink string `json:"download_link"`
+		ExpiresIn    int64  `json:"expires_in"`
+	} `json:"data"`
+}
+
+// FolderZipResp 文件夹打包下载链接响应结构
+type FolderZipResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		DownloadLink string `json:"download_link"`
+		ExpiresIn    int64  `json:"expires_in"`
+	} `json:"data"`
+}
+
+// FeaturesResp 后端功能列表响应结构
+type FeaturesResp struct {
+	Code int          `json:"code"`
+	Msg  string       `json:"msg"`
+	Data Capabilities `json:"data"`
+}
+
+// Capabilities 后端支持的可选功能，用于隐藏不可用的操作
+type Capabilities struct {
+	Copy            bool `json:"copy"`
+	Search          bool `json:"search"`
+	OfflineDownload bool `json:"offline_download"`
+	Archive         bool `json:"archive"`
+	Share           bool `json:"share"`
+}
+
+// BatchItem 批量操作请求中的单个条目
+type BatchItem struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	NewName string `json:"new_name,omitempty"`
+	// Modified 批量设置修改时间时的目标时间，格式为 "2006-01-02 15:04:05"
+	Modified string `json:"modified,omitempty"`
+}
+
+// BatchResp 批量操作响应结构，results 为每个条目的执行结果
+type BatchResp struct {
+	Envelope
+	Data struct {
+		Results []BatchItemResult `json:"results"`
+	} `json:"data"`
+}
+
+// BatchItemResult 批量操作中单个条目的执行结果
+type BatchItemResult struct {
+	ID      json.Number `json:"id"`
+	Success bool        `json:"success"`
+	Msg     string      `json:"msg"`
+	// NewID 复制等会产生新条目的操作返回的新对象ID
+	NewID json.Number `json:"new_id,omitempty"`
+}
+
+// BatchThumbsResp 批量缩略图响应结构，thumbnails 中只包含后端能生成缩略图的文件
+type BatchThumbsResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Thumbnails []struct {
+			ID           json.Number `json:"id"`
+			ThumbnailURL string      `json:"thumbnail_url"`
+		} `json:"thumbnails"`
+	} `json:"data"`
+}
+
+// FileStatsResp 文件统计信息响应结构
+type FileStatsResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		DownloadCount int64  `json:"download_count"`
+		LastAccessed  string `json:"last_accessed"`
+		ShareCount    int64  `json:"share_count"`
+	} `json:"data"`
+}
+
+// FileStats 文件的下载次数、最后访问时间和分享次数
+type FileStats struct {
+	DownloadCount int64
+	// LastAccessed 从未被访问时为零值
+	LastAccessed time.Time
+	ShareCount   int64
+}
+
+// SharesResp 对象已有分享列表响应结构
+type SharesResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Shares []struct {
+			ShareID   json.Number `json:"share_id"`
+			ShareURL  string      `json:"share_url"`
+			Password  string      `json:"password"`
+			Status    string      `json:"status"`
+			ExpiresAt string      `json:"expires_at"`
+		} `json:"shares"`
+	} `json:"data"`
+}
+
+// ShareResult 对象的一个分享链接
+type ShareResult struct {
+	ID  string
+	URL string
+	// Password 分享的提取码，未设置时为空
+	Password string
+	// ExpiresAt 分享的过期时间，永久有效时为零值
+	ExpiresAt time.Time
+}
+
+// OfflineCancelResp 取消离线下载任务响应结构，partial_file_id 为任务已写入的未完成文件
+type OfflineCancelResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		PartialFileID json.Number `json:"partial_file_id"`
+	} `json:"data"`
+}
+
+// ChangesResp 变更记录响应结构，next_cursor 用于下一次增量查询
+type ChangesResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Events []struct {
+			Type        string      `json:"type"`
+			ID          json.Number `json:"id"`
+			ItemType    string      `json:"item_type"`
+			Name        string      `json:"name"`
+			ParentID    json.Number `json:"parent_id"`
+			OldParentID json.Number `json:"old_parent_id"`
+			Time        string      `json:"time"`
+		} `json:"events"`
+		NextCursor string `json:"next_cursor"`
+	} `json:"data"`
+}
+
+// 变更事件的类型
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	ChangeMove   = "move"
+)
+
+// ChangeEvent 自某个游标以来发生的一次变更
+type ChangeEvent struct {
+	// Type 为 ChangeCreate、ChangeUpdate、ChangeDelete 或 ChangeMove
+	Type     string
+	ID       string
+	IsFolder bool
+	Name     string
+	ParentID string
+	// OldParentID 仅在移动事件中有值
+	OldParentID string
+	Time        time.Time
+}
+
+// TreeEntry 期望存在的文件或文件夹，Path 为相对于比较起点的路径，以 / 分隔
+type TreeEntry struct {
+	Path     string
+	Size     int64
+	IsFolder bool
+}
+
+// 目录树差异的类型
+const (
+	DiffMissing      = "missing"
+	DiffExtra        = "extra"
+	DiffSizeMismatch = "size_mismatch"
+	DiffTypeMismatch = "type_mismatch"
+)
+
+// TreeDiff 远端目录树与期望不一致的一个条目
+type TreeDiff struct {
+	Path string
+	// Kind 为 DiffMissing、DiffExtra、DiffSizeMismatch 或 DiffTypeMismatch
+	Kind string
+	// ExpectedSize 和 ActualSize 仅在对应一侧存在该条目时有效
+	ExpectedSize int64
+	ActualSize   int64
+}
+
+// File 文件信息结构
+type File struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+	IsFolder bool   `json:"is_folder"`
+}
+
+// Object 星辰云盘对象，在 model.Object 的基础上携带后端返回的扩展信息
+type Object struct {
+	model.Object
+	// ETag 文件内容的版本标识，可作为 UpdateContent 的 If-Match 前置条件
+	ETag string
+	// ParentID 父文件夹ID，列表或详情接口返回时填充
+	ParentID string
+	// Trashed 条目位于回收站中（仅在开启 IncludeTrashed 时出现在列表里）
+	Trashed bool
+	// Note 条目的备注
+	Note string
+	// FolderQuota 文件夹的容量上限（字节），0 表示不限制
+	FolderQuota int64
+	// FolderUsed 文件夹已使用的容量（字节）
+	FolderUsed int64
+	// HasChildren 文件夹是否包含子项，后端未提供时为nil
+	HasChildren *bool
+	// ChildCount 文件夹的子项数量，仅在后端返回 child_count 时有效
+	ChildCount int64
+	// MimeType 文件的内容类型，来自列表或 DetectMimeViaHead 的探测，未知时为空
+	MimeType string
+	// PreviewURL 文档的在线预览地址，后端未提供时为空
+	PreviewURL string
+	// PasswordProtected 文档设置了打开密码，无法在线预览
+	PasswordProtected bool
+}
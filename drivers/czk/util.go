@@ -1,3 +1,1167 @@
-package czk
-
-// 工具函数可以放在这里
\ No newline at end of file
+package czk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/driver"
+	"github.com/OpenListTeam/OpenList/v4/internal/errs"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/stream"
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/time/rate"
+)
+
+// ErrConflict 前置条件不满足（文件在读取后已被其他写入方修改）
+var ErrConflict = errors.New("file has been modified since it was read")
+
+// ErrFolderQuotaExceeded 目标文件夹的剩余容量不足
+var ErrFolderQuotaExceeded = errors.New("destination folder quota exceeded")
+
+// ErrScanRejected 上传的文件未通过后端的病毒扫描
+var ErrScanRejected = errors.New("file rejected by virus scan")
+
+// ErrUploadOffset 后端报告已收到的字节数超出文件大小，通常表示此前中断的上传数据已损坏
+var ErrUploadOffset = errors.New("server upload offset exceeds the file size")
+
+// ErrPasswordProtected 文档设置了打开密码，后端无法生成在线预览
+var ErrPasswordProtected = errors.New("document is password protected")
+
+// ErrRangeNotSupported 下载主机忽略了Range请求，返回的是整个文件
+var ErrRangeNotSupported = errors.New("download host does not support range requests")
+
+// ErrMaintenance 后端处于维护模式
+var ErrMaintenance = errors.New("service under maintenance")
+
+// maintenanceCode 响应体中表示后端维护中的业务码
+const maintenanceCode = 5030
+
+// errArchiveUnsupported 后端无法处理压缩包时返回：匹配 errs.NotSupport 表示后端缺少该能力，
+// 同时匹配 errs.NotImplement，OpenList 据此回退到内置的解压工具
+var errArchiveUnsupported = fmt.Errorf("%w: %w", errs.NotSupport, errs.NotImplement)
+
+// ErrTruncatedResponse 响应体不完整，通常是连接在传输过程中断开
+var ErrTruncatedResponse = errors.New("truncated response (connection likely dropped)")
+
+// truncatedRetries 响应体不完整时表单请求的最大重试次数
+const truncatedRetries = 2
+
+// 普通API请求与上传文件内容请求的超时时间
+const (
+	requestTimeout = 30 * time.Second
+	uploadTimeout  = 10 * time.Minute
+)
+
+// defaultBaseURL 未配置 BaseURL 时使用的星辰云盘API地址
+const defaultBaseURL = "https://pan.szczk.top/czkapi"
+
+// gzipMinSize 开启 GzipRequestBody 时需要压缩的最小请求体大小
+const gzipMinSize = 64 * 1024
+
+// 后台刷新令牌时提前于过期的时间，以及两次刷新之间的最小间隔
+var (
+	tokenWarmLead        = time.Minute
+	tokenWarmMinInterval = 5 * time.Second
+)
+
+// dropRevokeTimeout 卸载存储时注销令牌请求的最长等待时间
+var dropRevokeTimeout = 5 * time.Second
+
+// logDedupWindow 开启 DedupLogs 时合并重复日志的时间窗口
+var logDedupWindow = 10 * time.Second
+
+// 上传后病毒扫描的状态，以及等待扫描时的默认超时和轮询间隔
+const (
+	scanStatusScanning = "scanning"
+	scanStatusRejected = "rejected"
+	defaultScanTimeout = 2 * time.Minute
+)
+
+var scanPollInterval = 2 * time.Second
+
+// mimeProbeConcurrency DetectMimeViaHead 探测内容类型的并发数
+const mimeProbeConcurrency = 4
+
+// maxMimeProbesPerList 单次列表最多探测内容类型的文件数，避免大文件夹的列表发出大量请求
+var maxMimeProbesPerList = 32
+
+// linkWarmTimeout 预热下载链接的HEAD请求超时时间
+const linkWarmTimeout = 10 * time.Second
+
+// defaultGlobMaxDepth 未配置 GlobMaxDepth 时的递归深度
+const defaultGlobMaxDepth = 10
+
+// defaultPrewarmConcurrency 未配置 MaxConcurrentOps 时预先列出文件夹的并发数
+const defaultPrewarmConcurrency = 4
+
+// defaultPageSize 未配置 PageSize 时页码分页每页请求的条目数
+const defaultPageSize = 200
+
+// defaultMaxPages 未配置 MaxPages 时单次列表最多请求的页数
+const defaultMaxPages = 1000
+
+// 压缩包相关接口返回的业务码：密码缺失或错误、后端无法处理该格式
+const (
+	archivePasswordCode    = 4001
+	archiveUnsupportedCode = 4002
+)
+
+// offlineTaskFinishedCode 取消离线下载时表示任务已经结束的业务码
+const offlineTaskFinishedCode = 4091
+
+// defaultLinkExpiration 接口未返回有效期时下载链接的缓存时间
+const defaultLinkExpiration = 10 * time.Minute
+
+// defaultZipLinkExpiration 文件夹打包接口未返回有效期时下载链接的缓存时间
+const defaultZipLinkExpiration = 5 * time.Minute
+
+// emptyMD5 空内容的MD5，用于上传零字节文件
+const emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+
+// maxNoteLength 备注允许的最大字符数
+const maxNoteLength = 500
+
+// documentExts 使用后端在线预览的文档扩展名
+var documentExts = []string{"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "odt", "ods", "odp", "rtf"}
+
+// trashedPrefix 列表中回收站条目的名称前缀
+const trashedPrefix = "[trashed] "
+
+// futureTimeAllowance 开启 ClampFutureTimes 时允许修改时间超前当前时间的幅度，容忍轻微的时钟偏差
+const futureTimeAllowance = 5 * time.Minute
+
+// uploadProcessingCode 完成上传接口表示后端仍在处理上传内容的业务码
+const uploadProcessingCode = 202
+
+// 完成上传接口返回处理中时的最大重试次数与初始退避时间
+var (
+	completeMaxRetries     = 5
+	completeRetryBaseDelay = time.Second
+)
+
+// 上传单个分片失败时的最大重试次数与初始退避时间
+var (
+	chunkMaxRetries     = 3
+	chunkRetryBaseDelay = time.Second
+)
+
+// 认证接口被限流时的最大重试次数与初始退避时间
+var (
+	authMaxRetries     = 3
+	authRetryBaseDelay = time.Second
+)
+
+// envelopeError 检查响应体中的业务状态，HTTP 200 的响应也可能在响应体中表示失败
+// 不同接口分别使用 code 或 status 字段表示结果，msg 或 message 字段表示错误信息
+func envelopeError(body map[string]interface{}) (code int64, message string, failed bool) {
+	for _, key := range []string{"code", "status"} {
+		if v, ok := body[key].(float64); ok && int64(v) != 200 {
+			code, failed = int64(v), true
+			break
+		}
+	}
+	if !failed {
+		return 0, "", false
+	}
+	message = getStringValue(body["msg"])
+	if message == "" {
+		message = getStringValue(body["message"])
+	}
+	if message == "" {
+		message = "unknown error"
+	}
+	return code, message, true
+}
+
+// failed 按与 envelopeError 相同的规则检查类型化响应的业务状态，未返回的字段视为成功
+func (e Envelope) failed() (code int64, message string, failed bool) {
+	for _, c := range []int64{e.Code, e.Status} {
+		if c != 0 && c != 200 {
+			code, failed = c, true
+			break
+		}
+	}
+	if !failed {
+		return 0, "", false
+	}
+	message = e.Msg
+	if message == "" {
+		message = e.Message
+	}
+	if message == "" {
+		message = "unknown error"
+	}
+	return code, message, true
+}
+
+// batchFailure 返回批量操作中单个对象失败的原因，后端未返回该对象的结果或 msg 为空时使用通用描述
+func batchFailure(id string, result BatchItemResult, ok bool) string {
+	switch {
+	case result.Msg != "":
+		return result.Msg
+	case !ok:
+		return fmt.Sprintf("item %s failed: no result returned", id)
+	default:
+		return fmt.Sprintf("item %s failed", id)
+	}
+}
+
+// numberValue 将 json.Number 转换为整数，字段缺失或无法解析时 ok 为false
+func numberValue(n json.Number) (v int64, ok bool) {
+	if n == "" {
+		return 0, false
+	}
+	if v, err := n.Int64(); err == nil {
+		return v, true
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// tokenExpiredBody 判断错误响应体是否表示访问令牌已过期或失效
+func tokenExpiredBody(body []byte) bool {
+	var errResp map[string]interface{}
+	if decodeJSON(body, &errResp) != nil {
+		return false
+	}
+	if code, _, failed := envelopeError(errResp); failed && code == http.StatusUnauthorized {
+		return true
+	}
+	message := strings.ToLower(getStringValue(errResp["msg"]) + " " + getStringValue(errResp["message"]))
+	for _, hint := range []string{"token expired", "expired token", "invalid token", "令牌已过期", "令牌无效", "令牌过期"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupported 后端此前已被探测为缺少该接口时返回true，调用方直接返回 errs.NotSupport 而不再请求
+func (d *CZK) unsupported(capability string) bool {
+	_, ok := d.missingCaps.Load(capability)
+	return ok
+}
+
+// probeUnsupported 接口返回404或501时记录后端缺少该能力，之后的调用不再发出请求
+func (d *CZK) probeUnsupported(capability string, resp *resty.Response) bool {
+	if resp.StatusCode() != http.StatusNotFound && resp.StatusCode() != http.StatusNotImplemented {
+		return false
+	}
+	d.missingCaps.Store(capability, struct{}{})
+	return true
+}
+
+// installMiddleware 为客户端注册请求前后的处理：识别后端的维护模式并在冷却期内拒绝请求
+func (d *CZK) installMiddleware(client *resty.Client) {
+	client.OnBeforeRequest(func(_ *resty.Client, _ *resty.Request) error {
+		if until := d.maintenanceUntil.Load(); until > 0 && time.Now().UnixNano() < until {
+			return fmt.Errorf("%w, retry after %s", ErrMaintenance, time.Unix(0, until).Format(time.RFC3339))
+		}
+		return nil
+	})
+	// 每个请求在所有重试结束后只记录一次结果，5xx响应和网络错误计为失败
+	client.OnSuccess(func(_ *resty.Client, resp *resty.Response) {
+		if resp.StatusCode() >= http.StatusInternalServerError {
+			d.recordFailure()
+		} else {
+			d.recordSuccess()
+		}
+	})
+	client.OnError(func(_ *resty.Request, err error) {
+		if !errors.Is(err, context.Canceled) {
+			d.recordFailure()
+		}
+	})
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if !maintenanceResponse(resp) {
+			return nil
+		}
+		if d.MaintenanceCooldown > 0 {
+			cooldown := retryAfter(resp, time.Duration(d.MaintenanceCooldown)*time.Second)
+			d.maintenanceUntil.Store(time.Now().Add(cooldown).UnixNano())
+			d.warnf("CZK: service under maintenance, pausing requests for %v", cooldown)
+		}
+		return ErrMaintenance
+	})
+}
+
+// 5xx和网络错误自动重试时的初始等待时间与最长等待时间
+var (
+	retryWaitTime    = 500 * time.Millisecond
+	retryMaxWaitTime = 5 * time.Second
+)
+
+// configureRetry 按 RetryCount 配置客户端在网络错误和5xx响应时退避重试，4xx响应从不重试，避免掩盖认证失败；
+// 只重试幂等的请求，见 shouldRetry
+func (d *CZK) configureRetry(client *resty.Client) {
+	client.SetRetryCount(d.RetryCount).
+		SetRetryWaitTime(retryWaitTime).
+		SetRetryMaxWaitTime(retryMaxWaitTime).
+		AddRetryCondition(shouldRetry)
+}
+
+// shouldRetry 判断请求是否可以重试：只重试 GET/HEAD 和携带 Idempotency-Key 的请求，
+// 其他写操作超时后后端可能已经执行，重试会产生重复的文件夹或副本；
+// 请求体必须可以重放（表单请求体为 []byte），流式上传的请求体发送后无法重放，由分片重试处理；
+// 维护模式和取消的请求不重试
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	switch resp.Request.Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		if resp.Request.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	switch resp.Request.Body.(type) {
+	case nil, []byte, string:
+	default:
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, ErrMaintenance) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode() >= http.StatusInternalServerError
+}
+
+// recordFailure 记录一次失败的请求，连续失败达到 UnhealthyAfter 次时将存储标记为不健康
+func (d *CZK) recordFailure() {
+	n := d.consecutiveFailures.Add(1)
+	if d.UnhealthyAfter > 0 && n >= int64(d.UnhealthyAfter) && d.unhealthy.CompareAndSwap(false, true) {
+		d.warnf("CZK: %d consecutive requests failed, marking storage unhealthy", n)
+	}
+}
+
+// recordSuccess 记录一次成功的请求，清零连续失败次数并恢复健康状态
+func (d *CZK) recordSuccess() {
+	d.consecutiveFailures.Store(0)
+	if d.unhealthy.CompareAndSwap(true, false) {
+		log.Printf("CZK: request succeeded, storage is healthy again")
+	}
+}
+
+// maintenanceResponse 判断响应是否表示后端处于维护模式（X-Maintenance 响应头或维护业务码）
+func maintenanceResponse(resp *resty.Response) bool {
+	if v, err := strconv.ParseBool(resp.Header().Get("X-Maintenance")); err == nil && v {
+		return true
+	}
+	body := bytes.TrimPrefix(resp.Body(), utf8BOM)
+	if len(body) == 0 || body[0] != '{' {
+		return false
+	}
+	var envelope map[string]interface{}
+	if decodeJSON(body, &envelope) != nil {
+		return false
+	}
+	code, _, failed := envelopeError(envelope)
+	return failed && code == maintenanceCode
+}
+
+// traceIDHeader 后端在响应中返回的请求追踪ID，用户向后端支持反馈问题时需要提供
+const traceIDHeader = "X-Trace-Id"
+
+// traceSuffix 返回附加到错误信息末尾的追踪ID说明，响应没有追踪ID时返回空字符串
+func traceSuffix(resp *resty.Response) string {
+	if resp == nil {
+		return ""
+	}
+	if id := resp.Header().Get(traceIDHeader); id != "" {
+		return " (trace id: " + id + ")"
+	}
+	return ""
+}
+
+// retryAfter 优先使用响应中的 Retry-After（秒）作为等待时间，否则使用 fallback
+func retryAfter(resp *resty.Response, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header().Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// newTransport 根据配置创建客户端使用的HTTP传输层
+func (d *CZK) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if d.PreferIPv4 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, ipv4Network(network), addr)
+			if err == nil || ipv4Network(network) == network {
+				return conn, err
+			}
+			// 主机没有可用的IPv4地址时回退到默认的网络选择
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	if d.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: d.rootCAs}
+	}
+	// 非nil的空 TLSNextProto 关闭HTTP/2，同时只通过ALPN声明 http/1.1
+	if d.ForceHTTP1 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	return transport
+}
+
+// loadCACert 加载自定义CA证书，value 为PEM内容或证书文件路径
+// 自定义CA追加到系统证书池中，下载链接所在的公共CDN仍然可以通过校验
+func loadCACert(value string) (*x509.CertPool, error) {
+	pemData := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+		}
+		pemData = data
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("failed to parse CA certificate: no valid PEM certificate found")
+	}
+	return pool, nil
+}
+
+// throttleProgress 限制进度回调的频率：两次回调至少间隔 interval，达到100%时回调且只回调一次
+func throttleProgress(up driver.UpdateProgress, interval time.Duration) driver.UpdateProgress {
+	if up == nil {
+		return func(float64) {}
+	}
+	var last time.Time
+	done := false
+	return func(percentage float64) {
+		if done {
+			return
+		}
+		now := time.Now()
+		if percentage < 100 && now.Sub(last) < interval {
+			return
+		}
+		last, done = now, percentage >= 100
+		up(percentage)
+	}
+}
+
+// rateLimitBurstWindow 限速器允许的突发量，相当于该时长内可传输的字节数
+const rateLimitBurstWindow = 100 * time.Millisecond
+
+// newRateLimiter 创建每秒 kbps KB 的令牌桶限速器，kbps 不大于0时返回nil表示不限速
+func newRateLimiter(kbps int) *rate.Limiter {
+	if kbps <= 0 {
+		return nil
+	}
+	bytesPerSec := kbps * 1024
+	burst := max(int(float64(bytesPerSec)*rateLimitBurstWindow.Seconds()), 1)
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// limitedChunkReader 单次读取不超过 size 字节，使每次读取的字节数都不超过限速器的突发量
+type limitedChunkReader struct {
+	io.Reader
+	size int
+}
+
+func (r *limitedChunkReader) Read(p []byte) (int, error) {
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	return r.Reader.Read(p)
+}
+
+// cacheAndHash 缓存文件流并计算MD5
+// 不超过 InMemoryUploadMaxBytes 的文件直接读入内存，避免大量小文件上传时反复创建临时文件；
+// 更大的文件或已有缓存的文件仍交给 stream.CacheFullAndHash 处理
+func (d *CZK) cacheAndHash(file model.FileStreamer, up *driver.UpdateProgress) (io.ReaderAt, string, error) {
+	size := file.GetSize()
+	if size < 0 || size > d.InMemoryUploadMaxBytes || file.GetFile() != nil {
+		return stream.CacheFullAndHash(file, up, utils.MD5)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return nil, "", fmt.Errorf("failed to read file into memory: %w", err)
+	}
+	return bytes.NewReader(buf), utils.HashData(utils.MD5, buf), nil
+}
+
+// normalizeName 开启 NormalizeNames 时将名称转换为NFC形式
+func (d *CZK) normalizeName(name string) string {
+	if !d.NormalizeNames {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// ipv4Network 将通用的 tcp 网络类型限定为 tcp4
+func ipv4Network(network string) string {
+	if network == "tcp" {
+		return "tcp4"
+	}
+	return network
+}
+
+// 开启 PrefixIDs 时对象ID带有类型前缀，避免后端文件与文件夹共用数字ID时混淆
+const (
+	fileIDPrefix   = "f:"
+	folderIDPrefix = "d:"
+)
+
+// localID 将后端返回的ID转换为驱动内部使用的ID：开启 PrefixIDs 时加上类型前缀，根文件夹ID保持不变
+func (d *CZK) localID(id string, isFolder bool) string {
+	if !d.PrefixIDs || id == "" || id == d.RootFolderID {
+		return id
+	}
+	if isFolder {
+		return folderIDPrefix + id
+	}
+	return fileIDPrefix + id
+}
+
+// backendID 去掉内部ID的类型前缀，得到发送给后端的ID
+func backendID(id string) string {
+	if raw, ok := strings.CutPrefix(id, fileIDPrefix); ok {
+		return raw
+	}
+	if raw, ok := strings.CutPrefix(id, folderIDPrefix); ok {
+		return raw
+	}
+	return id
+}
+
+// cacheItem 缓存对象信息，用于之后查询父文件夹ID和类型。
+// 配置了 MaxCachedItems 时超出上限后淘汰最久未使用的对象
+func (d *CZK) cacheItem(obj *Object) {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	if d.items == nil {
+		d.items = make(map[string]*list.Element)
+		d.itemOrder = list.New()
+	}
+	if elem, ok := d.items[obj.GetID()]; ok {
+		elem.Value = obj
+		d.itemOrder.MoveToFront(elem)
+		return
+	}
+	d.items[obj.GetID()] = d.itemOrder.PushFront(obj)
+	for d.MaxCachedItems > 0 && d.itemOrder.Len() > d.MaxCachedItems {
+		oldest := d.itemOrder.Back()
+		d.itemOrder.Remove(oldest)
+		delete(d.items, oldest.Value.(*Object).GetID())
+	}
+}
+
+// cachedItem 从缓存中获取对象信息，命中的对象记为最近使用
+func (d *CZK) cachedItem(id string) (*Object, bool) {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	elem, ok := d.items[id]
+	if !ok {
+		return nil, false
+	}
+	d.itemOrder.MoveToFront(elem)
+	return elem.Value.(*Object), true
+}
+
+// invalidateSubtree 清除以 dirPath 为根的整个子树的缓存，包括驱动内的对象缓存和 OpenList 的列表缓存
+func (d *CZK) invalidateSubtree(dirPath string) {
+	if dirPath == "" {
+		return
+	}
+	prefix := strings.TrimSuffix(dirPath, "/") + "/"
+	d.cacheMu.Lock()
+	for id, elem := range d.items {
+		if strings.HasPrefix(elem.Value.(*Object).GetPath(), prefix) {
+			d.itemOrder.Remove(elem)
+			delete(d.items, id)
+		}
+	}
+	d.cacheMu.Unlock()
+	op.ClearCache(d, dirPath)
+}
+
+// parentOf 返回对象已知的父文件夹ID
+func (d *CZK) parentOf(obj model.Obj) (string, bool) {
+	if o, ok := obj.(*Object); ok && o.ParentID != "" {
+		return o.ParentID, true
+	}
+	if o, ok := d.cachedItem(obj.GetID()); ok && o.ParentID != "" {
+		return o.ParentID, true
+	}
+	return "", false
+}
+
+// itemByID 返回缓存中的对象，未缓存时按文件处理
+func (d *CZK) itemByID(id string) model.Obj {
+	if obj, ok := d.cachedItem(id); ok {
+		return obj
+	}
+	return &model.Object{ID: id}
+}
+
+// toArchiveTree 将压缩包条目转换为文件树，Path 为条目在压缩包内的路径
+func toArchiveTree(entries []ArchiveEntry, parent string) []model.ObjTree {
+	tree := make([]model.ObjTree, 0, len(entries))
+	for _, entry := range entries {
+		node := &model.ObjectTree{
+			Object: model.Object{
+				Path:     path.Join(parent, entry.Name),
+				Name:     entry.Name,
+				Size:     entry.Size,
+				IsFolder: entry.Type == "folder",
+			},
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05", entry.Modified); err == nil {
+			node.Modified = t
+		}
+		if node.IsFolder {
+			node.Children = toArchiveTree(entry.Children, node.Path)
+		}
+		tree = append(tree, node)
+	}
+	return tree
+}
+
+// opPermitKey 标记上下文已持有全局并发许可，避免嵌套调用重复获取导致死锁
+type opPermitKey struct{}
+
+// acquireOp 获取全局并发许可，返回带有许可标记的上下文和释放函数
+func (d *CZK) acquireOp(ctx context.Context) (context.Context, func(), error) {
+	if d.opSem == nil || ctx.Value(opPermitKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	select {
+	case d.opSem <- struct{}{}:
+		return context.WithValue(ctx, opPermitKey{}, true), func() { <-d.opSem }, nil
+	case <-ctx.Done():
+		return ctx, nil, ctx.Err()
+	}
+}
+
+// uploadPermitKey 标记上下文已持有上传并发许可
+type uploadPermitKey struct{}
+
+// acquireUpload 获取上传并发许可，应在 acquireOp 之前调用，避免等待上传许可时占用全局许可
+func (d *CZK) acquireUpload(ctx context.Context) (context.Context, func(), error) {
+	if d.uploadSem == nil || ctx.Value(uploadPermitKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	select {
+	case d.uploadSem <- struct{}{}:
+		return context.WithValue(ctx, uploadPermitKey{}, true), func() { <-d.uploadSem }, nil
+	case <-ctx.Done():
+		return ctx, nil, ctx.Err()
+	}
+}
+
+// freeName 返回在 existing 中未被占用的名称，依次尝试 "name (1).ext"、"name (2).ext"……
+func freeName(name string, existing map[string]model.Obj) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, ok := existing[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// itemType 返回接口中对象的类型参数
+func itemType(obj model.Obj) string {
+	if obj.IsDir() {
+		return "folder"
+	}
+	return "file"
+}
+
+// uploadHTTP 返回发送文件内容使用的客户端
+func (d *CZK) uploadHTTP() *resty.Client {
+	if d.uploadClient != nil {
+		return d.uploadClient
+	}
+	return d.client
+}
+
+// apiBase 返回不带末尾斜杠的API地址，未配置 BaseURL 时使用官方地址
+func (d *CZK) apiBase() string {
+	if base := strings.TrimRight(d.BaseURL, "/"); base != "" {
+		return base
+	}
+	return defaultBaseURL
+}
+
+// apiURL 返回 endpoint 接口的完整地址
+func (d *CZK) apiURL(endpoint string) string {
+	return d.apiBase() + "/" + endpoint
+}
+
+// absoluteURL 将相对下载路径与API主机的协议和域名拼接为绝对地址，绝对地址原样返回
+func (d *CZK) absoluteURL(link string) (string, error) {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if ref.IsAbs() {
+		return link, nil
+	}
+	base, err := url.Parse(d.apiBase())
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// accessToken 在 tokenMu 下读取当前的访问令牌，避免与刷新令牌的协程竞争
+func (d *CZK) accessToken() string {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	return d.AccessToken
+}
+
+// bearer 返回携带当前访问令牌的 Authorization 请求头值
+func (d *CZK) bearer() string {
+	return "Bearer " + d.accessToken()
+}
+
+// downloadHeader 返回下载链接使用的请求头
+// 只有链接指向API主机时才携带访问令牌，第三方CDN主机不需要认证，也不应收到令牌
+func (d *CZK) downloadHeader(link string) http.Header {
+	header := http.Header{"User-Agent": []string{"openlist"}}
+	u, err := url.Parse(link)
+	if err != nil {
+		return header
+	}
+	base, err := url.Parse(d.apiBase())
+	if err == nil && strings.EqualFold(u.Scheme, base.Scheme) && strings.EqualFold(u.Host, base.Host) {
+		header.Set("Authorization", d.bearer())
+	}
+	return header
+}
+
+// idempotencyKey 上下文中携带的幂等键，同一逻辑操作的所有重试共用
+type idempotencyKey struct{}
+
+// withIdempotencyKey 开启 IdempotencyKeys 时为一次逻辑操作生成新的幂等键，
+// 使超时后重试的请求不会在后端重复创建文件夹、文件或副本
+func (d *CZK) withIdempotencyKey(ctx context.Context) context.Context {
+	if !d.IdempotencyKeys {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKey{}, uuid.NewString())
+}
+
+// postForm 携带认证信息发送multipart表单请求
+// 开启 GzipRequestBody 且请求体不小于 gzipMinSize 时使用gzip压缩，后端返回415时改为不压缩重发，之后不再压缩
+// 开启 SignRequests 时对实际发送的请求体签名；响应体不完整时重试；上下文携带幂等键时附加 Idempotency-Key 头
+func (d *CZK) postForm(ctx context.Context, url string, writer *multipart.Writer, payload *bytes.Buffer) (*resty.Response, error) {
+	newReq := func(body []byte) *resty.Request {
+		req := d.client.R().
+			SetContext(ctx).
+			SetHeader("Authorization", d.bearer()).
+			SetHeader("Content-Type", writer.FormDataContentType()).
+			SetBody(body)
+		if d.SignRequests {
+			d.signRequest(req, url, body)
+		}
+		if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+			req.SetHeader("Idempotency-Key", key)
+		}
+		return req
+	}
+	body := payload.Bytes()
+	if d.GzipRequestBody && len(body) >= gzipMinSize && !d.gzipRejected.Load() {
+		compressed, err := gzipBytes(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gzip request body: %w", err)
+		}
+		resp, err := d.retryTruncated(func() (*resty.Response, error) {
+			return newReq(compressed).SetHeader("Content-Encoding", "gzip").Post(url)
+		})
+		if err != nil || resp.StatusCode() != http.StatusUnsupportedMediaType {
+			return resp, err
+		}
+		d.warnf("CZK postForm: server rejected gzip request body, disabling compression")
+		d.gzipRejected.Store(true)
+	}
+	return d.retryTruncated(func() (*resty.Response, error) {
+		return newReq(body).Post(url)
+	})
+}
+
+// retryTruncated 发送请求，连接中断导致响应体不完整时最多重试 truncatedRetries 次
+func (d *CZK) retryTruncated(send func() (*resty.Response, error)) (*resty.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := send()
+		truncated := errors.Is(err, io.ErrUnexpectedEOF)
+		if err == nil && resp.StatusCode() == http.StatusOK {
+			var v interface{}
+			truncated = errors.Is(decodeJSON(resp.Body(), &v), ErrTruncatedResponse)
+		}
+		if !truncated || attempt >= truncatedRetries {
+			if truncated && err == nil {
+				err = fmt.Errorf("%w: received %d bytes%s", ErrTruncatedResponse, len(resp.Body()), traceSuffix(resp))
+			}
+			return resp, err
+		}
+		d.warnf("CZK: truncated response (attempt %d/%d), retrying", attempt+1, truncatedRetries+1)
+	}
+}
+
+// utf8BOM 部分网关会在JSON响应体前附加的UTF-8字节序标记
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeJSON 解析JSON响应体，响应在中途被截断时返回 ErrTruncatedResponse 并附带已接收的字节数
+// 去掉开头的UTF-8 BOM；响应体不是UTF-8编码（如Latin-1）时返回明确的错误，而不是解析出乱码
+func decodeJSON(body []byte, v interface{}) error {
+	body = bytes.TrimPrefix(body, utf8BOM)
+	err := json.Unmarshal(body, v)
+	var syntaxErr *json.SyntaxError
+	// encoding/json 在输入提前结束时返回该固定信息的 SyntaxError
+	if errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &syntaxErr) && syntaxErr.Error() == "unexpected end of JSON input") {
+		return fmt.Errorf("%w: received %d bytes", ErrTruncatedResponse, len(body))
+	}
+	if !utf8.Valid(body) {
+		return fmt.Errorf("response body is not valid UTF-8, the server may be using another charset")
+	}
+	return err
+}
+
+// signRequest 使用 APISecret 对请求签名，附加 X-Timestamp 与 X-Signature 请求头
+func (d *CZK) signRequest(req *resty.Request, rawURL string, body []byte) {
+	reqPath := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		reqPath = u.EscapedPath()
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.SetHeader("X-Timestamp", timestamp).
+		SetHeader("X-Signature", signPayload(d.APISecret, timestamp, reqPath, body))
+}
+
+// signPayload 计算 HMAC-SHA256(secret, timestamp + "\n" + path + "\n" + body)，返回十六进制字符串
+func signPayload(secret, timestamp, reqPath string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + reqPath + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// gzipBytes 使用gzip压缩数据
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// matchGlob 判断相对路径是否匹配模式，** 匹配零个或多个目录层级，其余按 path.Match 逐级匹配
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// warmLink 向下载链接发送HEAD请求以预热CDN，失败时忽略
+// 请求不随 Link 调用结束而取消，但受 linkWarmTimeout 限制
+func (d *CZK) warmLink(ctx context.Context, link *model.Link) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), linkWarmTimeout)
+	defer cancel()
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeaderMultiValues(link.Header).
+		Head(link.URL)
+	if err != nil {
+		d.warnf("CZK warmLink: failed to warm %s: %v", link.URL, err)
+		return
+	}
+	log.Printf("CZK warmLink: warmed download link with status %d", resp.StatusCode())
+}
+
+// detectMimeTypes 并发探测列表中内容类型未知的文件，并发数为 mimeProbeConcurrency，
+// 单次列表最多探测 maxMimeProbesPerList 个未缓存的文件，其余留待之后的列表继续探测；ctx 取消时停止
+func (d *CZK) detectMimeTypes(ctx context.Context, objs []model.Obj) {
+	var g errgroup.Group
+	g.SetLimit(mimeProbeConcurrency)
+	probes := 0
+	for _, obj := range objs {
+		o, ok := obj.(*Object)
+		if !ok || o.IsDir() || o.MimeType != "" || utils.GetMimeType(o.GetName()) != "application/octet-stream" {
+			continue
+		}
+		if v, ok := d.mimeTypes.Load(o.GetID()); ok {
+			o.MimeType = v.(string)
+			continue
+		}
+		if probes >= maxMimeProbesPerList || ctx.Err() != nil {
+			break
+		}
+		probes++
+		g.Go(func() error {
+			if ctx.Err() == nil {
+				o.MimeType = d.detectMimeType(ctx, o)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// detectMimeType 扩展名无法确定内容类型时，对文件的下载链接发送HEAD请求读取 Content-Type
+// 结果按文件ID缓存，探测失败时返回空字符串且不缓存，下次列表时重试
+func (d *CZK) detectMimeType(ctx context.Context, obj model.Obj) string {
+	if utils.GetMimeType(obj.GetName()) != "application/octet-stream" {
+		return ""
+	}
+	if v, ok := d.mimeTypes.Load(obj.GetID()); ok {
+		return v.(string)
+	}
+	link, err := d.Link(ctx, obj, model.LinkArgs{})
+	if err != nil {
+		d.warnf("CZK detectMimeType: failed to get link of %s: %v", obj.GetID(), err)
+		return ""
+	}
+	resp, err := d.client.R().
+		SetContext(ctx).
+		SetHeaderMultiValues(link.Header).
+		Head(link.URL)
+	if err != nil {
+		d.warnf("CZK detectMimeType: HEAD of %s failed: %v", obj.GetID(), err)
+		return ""
+	}
+	if resp.StatusCode() != http.StatusOK {
+		d.warnf("CZK detectMimeType: HEAD of %s returned status %d", obj.GetID(), resp.StatusCode())
+		return ""
+	}
+	mimeType, _, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	d.mimeTypes.Store(obj.GetID(), mimeType)
+	return mimeType
+}
+
+// throttledRangeReader 返回经过 downloadLimiter 限速的分段读取器，仅在下载经由本机代理时生效
+func (d *CZK) throttledRangeReader(link *model.Link) model.RangeReaderIF {
+	return stream.RangeReaderFunc(func(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create download request: %w", err)
+		}
+		req.Header = http_range.ApplyRangeToHttpHeader(httpRange, link.Header.Clone())
+		resp, err := d.client.GetClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send download request: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("failed to download with status %d", resp.StatusCode)
+		}
+		var body io.Reader = resp.Body
+		// 下载主机忽略Range时跳过起始偏移之前的内容
+		if resp.StatusCode == http.StatusOK && httpRange.Start > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, httpRange.Start); err != nil {
+				_ = resp.Body.Close()
+				return nil, fmt.Errorf("failed to skip to range start: %w", err)
+			}
+			if httpRange.Length >= 0 {
+				body = io.LimitReader(resp.Body, httpRange.Length)
+			}
+		}
+		return utils.NewReadCloser(&stream.RateLimitReader{
+			Reader:  &limitedChunkReader{Reader: body, size: d.downloadLimiter.Burst()},
+			Limiter: d.downloadLimiter,
+			Ctx:     ctx,
+		}, resp.Body.Close), nil
+	})
+}
+
+// saveTokens 将当前令牌写入 Addition 并保存存储配置，使重启后可以复用。
+// 存储尚未保存到数据库（ID为0）时只更新内存中的配置
+func (d *CZK) saveTokens() {
+	d.SavedAccessToken = d.AccessToken
+	d.SavedRefreshToken = d.RefreshToken
+	d.SavedTokenExpiry = d.ExpiresAt.Unix()
+	d.SavedTokenKey = d.APIKey
+	if d.ID != 0 {
+		op.MustSaveDriverStorage(d)
+	}
+}
+
+// checkRestoredToken 确认后端仍接受恢复的访问令牌，令牌已被注销时刷新，刷新失败则重新认证
+// 检查请求本身失败时继续使用恢复的令牌，不因网络问题阻止存储加载
+func (d *CZK) checkRestoredToken(ctx context.Context) error {
+	token := d.accessToken()
+	ok, err := d.tokenAccepted(ctx, token)
+	if err != nil {
+		d.warnf("CZK Init: failed to check saved token: %v", err)
+		return nil
+	}
+	if !ok {
+		log.Printf("CZK Init: saved token was rejected, renewing")
+		return d.renewToken(ctx, "CZK Init", token)
+	}
+	log.Printf("CZK Init: reusing saved token, expires at: %v", d.ExpiresAt)
+	return nil
+}
+
+// restoreTokens 恢复上次保存的令牌，没有为当前 APIKey 保存的令牌时返回 false
+func (d *CZK) restoreTokens() bool {
+	if d.SavedAccessToken == "" || d.SavedRefreshToken == "" || d.SavedTokenKey != d.APIKey {
+		return false
+	}
+	d.AccessToken = d.SavedAccessToken
+	d.RefreshToken = d.SavedRefreshToken
+	d.ExpiresAt = time.Unix(d.SavedTokenExpiry, 0)
+	return true
+}
+
+// startTokenWarmer 启动在令牌过期前主动刷新的后台协程
+func (d *CZK) startTokenWarmer() {
+	d.stopTokenWarmer(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.warmerCancel, d.warmerDone = cancel, done
+	go func() {
+		defer close(done)
+		for {
+			d.tokenMu.Lock()
+			wait := time.Until(d.ExpiresAt) - tokenWarmLead
+			d.tokenMu.Unlock()
+			if wait < tokenWarmMinInterval {
+				wait = tokenWarmMinInterval
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if err := d.renewToken(ctx, "CZK keepTokenWarm", d.accessToken()); err != nil {
+				d.warnf("CZK keepTokenWarm: failed to re-authenticate: %v", err)
+			}
+		}
+	}()
+}
+
+// stopTokenWarmer 停止后台刷新协程并等待其退出，ctx 结束时不再等待
+func (d *CZK) stopTokenWarmer(ctx context.Context) {
+	if d.warmerCancel == nil {
+		return
+	}
+	d.warmerCancel()
+	select {
+	case <-d.warmerDone:
+	case <-ctx.Done():
+	}
+	d.warmerCancel, d.warmerDone = nil, nil
+}
+
+// dedupLogger 合并时间窗口内连续重复的日志行，重复结束时输出一条带重复次数的汇总
+type dedupLogger struct {
+	mu     sync.Mutex
+	last   string
+	lastAt time.Time
+	repeat int
+}
+
+func (l *dedupLogger) printf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if msg == l.last && now.Sub(l.lastAt) < logDedupWindow {
+		l.repeat++
+		l.lastAt = now
+		return
+	}
+	l.flushLocked()
+	l.last, l.lastAt = msg, now
+	log.Print(msg)
+}
+
+// flush 输出尚未汇总的重复次数
+func (l *dedupLogger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushLocked()
+}
+
+func (l *dedupLogger) flushLocked() {
+	if l.repeat > 0 {
+		log.Printf("%s (repeated %d times)", l.last, l.repeat)
+		l.repeat = 0
+	}
+}
+
+// warnf 记录警告或错误日志，开启 DedupLogs 时合并连续重复的日志
+func (d *CZK) warnf(format string, args ...interface{}) {
+	if d.DedupLogs {
+		d.logs.printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
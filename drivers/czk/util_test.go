@@ -0,0 +1,232 @@
+package czk
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+func TestPreferIPv4(t *testing.T) {
+	if got := ipv4Network("tcp"); got != "tcp4" {
+		t.Errorf("expect tcp4 network, got %s", got)
+	}
+	if (&CZK{}).newTransport().DialContext == nil {
+		t.Errorf("expect default transport to keep a dialer")
+	}
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("ipv4 loopback unavailable: %+v", err)
+	}
+	defer l.Close()
+	d := &CZK{}
+	d.PreferIPv4 = true
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	conn, err := d.newTransport().DialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+	defer conn.Close()
+	if ip := conn.RemoteAddr().(*net.TCPAddr).IP; ip.To4() == nil {
+		t.Errorf("expect an IPv4 connection, got %s", ip)
+	}
+}
+
+func TestCustomCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&http.Client{Transport: (&CZK{}).newTransport()}).Get(srv.URL); err == nil {
+		t.Fatalf("expect the private CA to be untrusted by default")
+	}
+	for _, value := range []string{string(caPEM), caFile} {
+		pool, err := loadCACert(value)
+		if err != nil {
+			t.Fatalf("failed to load CA: %+v", err)
+		}
+		d := &CZK{rootCAs: pool}
+		resp, err := (&http.Client{Transport: d.newTransport()}).Get(srv.URL)
+		if err != nil {
+			t.Fatalf("expect a certificate signed by the custom CA to be trusted: %+v", err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := loadCACert("-----BEGIN CERTIFICATE-----\nnot a cert\n-----END CERTIFICATE-----"); err == nil || !strings.Contains(err.Error(), "failed to parse CA certificate") {
+		t.Errorf("expect a parse error for an invalid CA, got %v", err)
+	}
+}
+
+func TestForceHTTP1(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	for forceHTTP1, expect := range map[bool]string{false: "HTTP/2.0", true: "HTTP/1.1"} {
+		d := &CZK{rootCAs: pool}
+		d.ForceHTTP1 = forceHTTP1
+		transport := d.newTransport()
+		if forceHTTP1 && (transport.TLSNextProto == nil || len(transport.TLSNextProto) != 0) {
+			t.Errorf("expect an empty non-nil TLSNextProto to disable HTTP/2")
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to request: %+v", err)
+		}
+		resp.Body.Close()
+		if resp.Proto != expect {
+			t.Errorf("ForceHTTP1=%v: expect %s, got %s", forceHTTP1, expect, resp.Proto)
+		}
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	tests := map[string]string{
+		"/files/download/1?sign=abc&e=1": "https://pan.szczk.top/files/download/1?sign=abc&e=1",
+		"https://cdn.example.com/f?x=1":  "https://cdn.example.com/f?x=1",
+	}
+	for link, expect := range tests {
+		got, err := (&CZK{}).absoluteURL(link)
+		if err != nil {
+			t.Errorf("failed to resolve %s: %+v", link, err)
+		} else if got != expect {
+			t.Errorf("expect %s, got %s", expect, got)
+		}
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	const expect = "a9b805813e51eac98664aa85c3ad6a72289acc90131fd9c40da6cc8205e4386a"
+	if got := signPayload("test-secret", "1700000000", "/czkapi/create_folder", []byte("folder_name=docs")); got != expect {
+		t.Errorf("expect signature %s, got %s", expect, got)
+	}
+}
+
+func TestDecodeJSONTruncated(t *testing.T) {
+	var v map[string]interface{}
+	err := decodeJSON([]byte(`{"code":200,"data":{"folder_id":`), &v)
+	if !errors.Is(err, ErrTruncatedResponse) || !strings.Contains(err.Error(), "received 32 bytes") {
+		t.Errorf("expect truncated response error with byte count, got %v", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if err := decodeJSON([]byte(`{"code":}`), &v); errors.Is(err, ErrTruncatedResponse) || !errors.As(err, &syntaxErr) {
+		t.Errorf("expect malformed JSON to stay a syntax error, got %v", err)
+	}
+}
+
+func TestDecodeJSONEncoding(t *testing.T) {
+	var v map[string]interface{}
+	if err := decodeJSON([]byte("\xEF\xBB\xBF{\"code\":200,\"msg\":\"成功\"}"), &v); err != nil || v["msg"] != "成功" {
+		t.Errorf("expect a BOM-prefixed body to parse, got %v, %v", v, err)
+	}
+	// Latin-1 编码的 "café"
+	if err := decodeJSON([]byte("{\"name\":\"caf\xE9\"}"), &v); err == nil || !strings.Contains(err.Error(), "not valid UTF-8") {
+		t.Errorf("expect an encoding error for a Latin-1 body, got %v", err)
+	}
+}
+
+func TestEnvelopeError(t *testing.T) {
+	tests := []struct {
+		body    string
+		code    int64
+		message string
+		failed  bool
+	}{
+		{`{"code":200,"data":{}}`, 0, "", false},
+		{`{"status":200}`, 0, "", false},
+		{`{"data":{}}`, 0, "", false},
+		{`{"code":404,"msg":"文件不存在"}`, 404, "文件不存在", true},
+		{`{"status":500,"message":"busy"}`, 500, "busy", true},
+		{`{"code":200,"status":403}`, 403, "unknown error", true},
+	}
+	for _, tt := range tests {
+		var body map[string]interface{}
+		_ = json.Unmarshal([]byte(tt.body), &body)
+		code, message, failed := envelopeError(body)
+		if code != tt.code || message != tt.message || failed != tt.failed {
+			t.Errorf("%s: expect (%d, %q, %v), got (%d, %q, %v)", tt.body, tt.code, tt.message, tt.failed, code, message, failed)
+		}
+	}
+}
+
+func TestDedupLogs(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	d := &CZK{}
+	d.DedupLogs = true
+	for i := 0; i < 4; i++ {
+		d.warnf("CZK authenticate: rate limited (429), retrying in %v", time.Second)
+	}
+	d.warnf("CZK Put: failed to re-list %s", "0")
+	d.warnf("CZK Put: failed to re-list %s", "0")
+	d.logs.flush()
+	out := buf.String()
+	if n := strings.Count(out, "rate limited (429), retrying in 1s\n"); n != 1 {
+		t.Errorf("expect the repeated line to be printed once, got %d times:\n%s", n, out)
+	}
+	if !strings.Contains(out, "rate limited (429), retrying in 1s (repeated 3 times)") || !strings.Contains(out, "failed to re-list 0 (repeated 1 times)") {
+		t.Errorf("expect repeat summaries, got:\n%s", out)
+	}
+}
+
+func TestItemCacheEviction(t *testing.T) {
+	d := &CZK{}
+	d.MaxCachedItems = 3
+	for _, id := range []string{"1", "2", "3"} {
+		d.cacheItem(&Object{Object: model.Object{ID: id}, ParentID: "0"})
+	}
+	// 访问 1 使其成为最近使用，随后加入的条目应淘汰 2 和 3
+	if _, ok := d.cachedItem("1"); !ok {
+		t.Fatalf("expect item 1 to be cached")
+	}
+	d.cacheItem(&Object{Object: model.Object{ID: "4"}})
+	d.cacheItem(&Object{Object: model.Object{ID: "5"}})
+	for id, expect := range map[string]bool{"1": true, "2": false, "3": false, "4": true, "5": true} {
+		if _, ok := d.cachedItem(id); ok != expect {
+			t.Errorf("item %s: expect cached=%v, got %v", id, expect, ok)
+		}
+	}
+	if len(d.items) != 3 || d.itemOrder.Len() != 3 {
+		t.Errorf("expect the cache to stay at its cap, got %d entries", len(d.items))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := strconv.Itoa(i*100 + j)
+				d.cacheItem(&Object{Object: model.Object{ID: id}})
+				d.cachedItem(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(d.items) != 3 || d.itemOrder.Len() != 3 {
+		t.Errorf("expect concurrent use to respect the cap, got %d entries", len(d.items))
+	}
+}